@@ -0,0 +1,301 @@
+// Package asm assembles programs written in the syntax of the Octo assembler into CHIP-8, SUPER-CHIP and
+// XO-CHIP ROMs.
+//
+// The supported subset covers labels, :alias, :const, :macro, :org, :byte, :call, loop/again/while,
+// if ... then and if ... begin/else/end, the data bytes and every statement of the instruction set.
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Origin is the address programs are loaded at.
+const Origin = 0x200
+
+// Error is an error in the source, located at a line and a column, both starting at 1.
+type Error struct {
+	File      string
+	Line, Col int
+	Msg       string
+}
+
+func (e Error) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, e.Msg)
+}
+
+// Program is an assembled program.
+type Program struct {
+	Origin uint16
+	Bytes  []byte
+	// Symbols holds the address of every label.
+	Symbols Symbols
+	// Lines holds the line of the source every instruction was assembled from, by address.
+	Lines map[uint16]int
+}
+
+// Symbols holds the addresses of the labels of a program, by name.
+type Symbols map[string]uint16
+
+// Nearest returns the closest symbol at or before addr and the offset of addr from it. Of the symbols at
+// the same address, the first in alphabetical order is returned. ok is false when there is none.
+func (s Symbols) Nearest(addr uint16) (name string, offset uint16, ok bool) {
+	var at uint16
+	for n, a := range s {
+		if a > addr || (ok && (a < at || a == at && n > name)) {
+			continue
+		}
+		name, at, ok = n, a, true
+	}
+	if !ok {
+		return "", 0, false
+	}
+	return name, addr - at, true
+}
+
+// WriteSymbols writes the symbol map of the program to w, one "0x0200 main" line per label, ordered by address.
+func (p *Program) WriteSymbols(w io.Writer) error {
+	names := make([]string, 0, len(p.Symbols))
+	for name := range p.Symbols {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if p.Symbols[names[i]] != p.Symbols[names[j]] {
+			return p.Symbols[names[i]] < p.Symbols[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		fmt.Fprintf(bw, "0x%04X %s\n", p.Symbols[name], name)
+	}
+	return bw.Flush()
+}
+
+// ReadSymbols reads a symbol map written by WriteSymbols.
+func ReadSymbols(r io.Reader) (Symbols, error) {
+	symbols := Symbols{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected an address and a name", line)
+		}
+		addr, err := strconv.ParseUint(fields[0], 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, fields[0])
+		}
+		symbols[fields[1]] = uint16(addr)
+	}
+	return symbols, scanner.Err()
+}
+
+// Assemble assembles the source of a program. file is only used to locate the errors.
+func Assemble(file string, src []byte) (*Program, error) {
+	a := &assembler{
+		file:    file,
+		tokens:  tokenize(string(src)),
+		here:    Origin,
+		end:     Origin,
+		labels:  map[string]uint16{},
+		consts:  map[string]int{},
+		aliases: map[string]uint8{},
+		macros:  map[string]macro{},
+		lines:   map[uint16]int{},
+	}
+	// Execution starts at the origin, where a jump to main is placed unless main comes first.
+	a.emit(0x10, 0x00)
+	a.mainJump = true
+
+	for !a.eof() {
+		if err := a.statement(); err != nil {
+			return nil, err
+		}
+	}
+	return a.finish()
+}
+
+type macro struct {
+	args []string
+	body []token
+}
+
+// fixup is an operand referring to a label defined later in the source.
+type fixup struct {
+	tok  token
+	addr int
+	// long is set for the 16 bits address of i := long, otherwise the operand is the
+	// lowest 12 bits of the instruction.
+	long bool
+}
+
+// block is an open loop or if ... begin.
+type block struct {
+	tok token
+	// addr is the start of a loop, or the jump over the body of an if ... begin.
+	addr int
+	// whiles holds the jumps out of a loop.
+	whiles []int
+}
+
+// maxExpansions bounds the macro expansions, so that a recursive macro is reported instead of hanging.
+const maxExpansions = 10000
+
+type assembler struct {
+	file   string
+	tokens []token
+	pos    int
+
+	mem       [0x10000]byte
+	here, end int
+	mainJump  bool
+
+	labels     map[string]uint16
+	consts     map[string]int
+	aliases    map[string]uint8
+	macros     map[string]macro
+	fixups     []fixup
+	blocks     []block
+	expansions int
+
+	// line is the line of the statement being assembled.
+	line  int
+	lines map[uint16]int
+}
+
+func (a *assembler) errorf(tok token, format string, args ...interface{}) error {
+	return Error{File: a.file, Line: tok.line, Col: tok.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (a *assembler) eof() bool {
+	return a.pos >= len(a.tokens)
+}
+
+// next returns the next token, or an error located at the last token at the end of the source.
+func (a *assembler) next() (token, error) {
+	if a.eof() {
+		last := token{line: 1, col: 1}
+		if len(a.tokens) > 0 {
+			last = a.tokens[len(a.tokens)-1]
+			last.col += len([]rune(last.text))
+		}
+		return token{}, a.errorf(last, "unexpected end of file")
+	}
+	tok := a.tokens[a.pos]
+	a.pos++
+	return tok, nil
+}
+
+// peek returns the text of the next token, or "" at the end of the source.
+func (a *assembler) peek() string {
+	if a.eof() {
+		return ""
+	}
+	return a.tokens[a.pos].text
+}
+
+// expect consumes the next token, which must be text.
+func (a *assembler) expect(text string) error {
+	tok, err := a.next()
+	if err != nil {
+		return err
+	}
+	if tok.text != text {
+		return a.errorf(tok, "expected %q, found %q", text, tok.text)
+	}
+	return nil
+}
+
+func (a *assembler) emit(b ...byte) error {
+	for _, v := range b {
+		if a.here >= len(a.mem) {
+			return a.errorf(a.tokens[a.pos-1], "program does not fit in memory")
+		}
+		a.mem[a.here] = v
+		a.here++
+	}
+	if a.here > a.end {
+		a.end = a.here
+	}
+	return nil
+}
+
+// emitOp emits an instruction and records the line it comes from.
+func (a *assembler) emitOp(op uint16) error {
+	if a.line > 0 && a.here < len(a.mem) {
+		a.lines[uint16(a.here)] = a.line
+	}
+	return a.emit(byte(op>>8), byte(op))
+}
+
+// patch sets the address of the jump at addr to target. tok locates the error when target does not fit
+// in 12 bits.
+func (a *assembler) patch(tok token, addr int, target int) error {
+	if target > 0xFFF {
+		return a.errorf(tok, "0x%04X is beyond the 12 bits addresses", target)
+	}
+	a.mem[addr] = a.mem[addr]&0xF0 | byte(target>>8)
+	a.mem[addr+1] = byte(target)
+	return nil
+}
+
+func (a *assembler) finish() (*Program, error) {
+	if len(a.blocks) > 0 {
+		b := a.blocks[len(a.blocks)-1]
+		if b.tok.text == "loop" {
+			return nil, a.errorf(b.tok, "loop without again")
+		}
+		return nil, a.errorf(b.tok, "%s without end", b.tok.text)
+	}
+	for _, f := range a.fixups {
+		addr, ok := a.labels[f.tok.text]
+		if !ok {
+			return nil, a.errorf(f.tok, "undefined label %q", f.tok.text)
+		}
+		if f.long {
+			a.mem[f.addr] = byte(addr >> 8)
+			a.mem[f.addr+1] = byte(addr)
+			continue
+		}
+		if err := a.patch(f.tok, f.addr, int(addr)); err != nil {
+			return nil, err
+		}
+	}
+
+	main, ok := a.labels["main"]
+	if !ok {
+		return nil, Error{File: a.file, Line: 1, Col: 1, Msg: "the program has no main label"}
+	}
+	if a.mainJump {
+		if err := a.patch(token{line: 1, col: 1}, Origin, int(main)); err != nil {
+			return nil, err
+		}
+	}
+
+	symbols := make(Symbols, len(a.labels))
+	for name, addr := range a.labels {
+		symbols[name] = addr
+	}
+	lines := map[uint16]int{}
+	for addr, line := range a.lines {
+		if int(addr) >= Origin && int(addr) < a.end {
+			lines[addr] = line
+		}
+	}
+	return &Program{
+		Origin:  Origin,
+		Bytes:   append([]byte(nil), a.mem[Origin:a.end]...),
+		Symbols: symbols,
+		Lines:   lines,
+	}, nil
+}
@@ -0,0 +1,97 @@
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []byte
+	}{
+		{": main clear return", []byte{0x00, 0xE0, 0x00, 0xEE}},
+		{": main v1 := 0x2A v2 += 3 v1 := v2", []byte{0x61, 0x2A, 0x72, 0x03, 0x81, 0x20}},
+		{
+			": main v1 |= v2 v1 &= v2 v1 ^= v2 v1 += v2 v1 -= v2 v1 >>= v2 v1 =- v2 v1 <<= v2",
+			[]byte{0x81, 0x21, 0x81, 0x22, 0x81, 0x23, 0x81, 0x24, 0x81, 0x25, 0x81, 0x26, 0x81, 0x27, 0x81, 0x2E},
+		},
+		{": main i := data sprite v0 v1 5 : data 0xF0 0x90", []byte{0xA2, 0x04, 0xD0, 0x15, 0xF0, 0x90}},
+		{": main loop v0 += 1 if v0 != 10 then again", []byte{0x70, 0x01, 0x30, 0x0A, 0x12, 0x00}},
+		// main does not come first, so the program starts with a jump to it.
+		{": sub return : main sub", []byte{0x12, 0x04, 0x00, 0xEE, 0x22, 0x02}},
+		{":const N 5 : main v3 := N", []byte{0x63, 0x05}},
+		{":alias x v4 : main x := 1", []byte{0x64, 0x01}},
+		{": main i := long target : target", []byte{0xF0, 0x00, 0x02, 0x04}},
+		{":macro twice R { R += 1 R += 1 } : main twice v2", []byte{0x72, 0x01, 0x72, 0x01}},
+		{
+			": main v0 := random 0x0F delay := v0 buzzer := v0 v0 := delay v0 := key",
+			[]byte{0xC0, 0x0F, 0xF0, 0x15, 0xF0, 0x18, 0xF0, 0x07, 0xF0, 0x0A},
+		},
+		{
+			": main save v3 load v3 bcd v1 i += v2 i := hex v1 i := bighex v1",
+			[]byte{0xF3, 0x55, 0xF3, 0x65, 0xF1, 0x33, 0xF2, 0x1E, 0xF1, 0x29, 0xF1, 0x30},
+		},
+	}
+	for _, tt := range tests {
+		p, err := Assemble("", []byte(tt.src))
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if !bytes.Equal(p.Bytes, tt.want) {
+			t.Errorf("%q: % X, want % X", tt.src, p.Bytes, tt.want)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		src       string
+		line, col int
+		msg       string
+	}{
+		{": main v0 := 256", 1, 14, "256 is out of range [-128, 255]"},
+		{": main v0 := v16", 1, 14, `expected a number, found "v16"`},
+		{": main jump nowhere", 1, 13, `undefined label "nowhere"`},
+		{": main\n  loop\n", 2, 3, "loop without again"},
+		{": main if v0 == 1 begin clear", 1, 19, "begin without end"},
+		{": main\n: main", 2, 3, `label "main" is already defined`},
+		{"clear", 1, 1, "the program has no main label"},
+	}
+	for _, tt := range tests {
+		_, err := Assemble("test.8o", []byte(tt.src))
+		var asmErr Error
+		if !errors.As(err, &asmErr) {
+			t.Errorf("%q: error %v, want an Error", tt.src, err)
+			continue
+		}
+		want := Error{File: "test.8o", Line: tt.line, Col: tt.col, Msg: tt.msg}
+		if asmErr != want {
+			t.Errorf("%q: %v, want %v", tt.src, asmErr, want)
+		}
+	}
+}
+
+func TestSymbolsNearest(t *testing.T) {
+	symbols := Symbols{"main": 0x200, "draw": 0x210, "sprite": 0x220, "alias": 0x220}
+	tests := []struct {
+		addr   uint16
+		name   string
+		offset uint16
+		ok     bool
+	}{
+		{0x1FF, "", 0, false},
+		{0x200, "main", 0, true},
+		{0x20E, "main", 14, true},
+		{0x210, "draw", 0, true},
+		{0x224, "alias", 4, true},
+	}
+	for _, tt := range tests {
+		name, offset, ok := symbols.Nearest(tt.addr)
+		if name != tt.name || offset != tt.offset || ok != tt.ok {
+			t.Errorf("Nearest(0x%03X) = %q, %d, %v, want %q, %d, %v", tt.addr, name, offset, ok, tt.name, tt.offset, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LineMap maps the addresses of the instructions to the lines of the source they were assembled from,
+// so that debuggers can show the source of a program.
+//
+// It is stored as text: a "source PATH" line naming the source, followed by one "0x0200 12" line per
+// instruction giving its address and its line, ordered by address.
+type LineMap struct {
+	Source string
+	Lines  map[uint16]int
+}
+
+// LineMap returns the line map of the program, which was assembled from source.
+func (p *Program) LineMap(source string) *LineMap {
+	return &LineMap{Source: source, Lines: p.Lines}
+}
+
+// Write writes the line map to w.
+func (m *LineMap) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "source %s\n", m.Source)
+	for _, addr := range m.addresses() {
+		fmt.Fprintf(bw, "0x%04X %d\n", addr, m.Lines[addr])
+	}
+	return bw.Flush()
+}
+
+// ReadLineMap reads a line map written by LineMap.Write.
+func ReadLineMap(r io.Reader) (*LineMap, error) {
+	m := &LineMap{Lines: map[uint16]int{}}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "source ") {
+			m.Source = strings.TrimSpace(strings.TrimPrefix(text, "source "))
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected an address and a line", n)
+		}
+		addr, err := strconv.ParseUint(fields[0], 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", n, fields[0])
+		}
+		line, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid line %q", n, fields[1])
+		}
+		m.Lines[uint16(addr)] = line
+	}
+	return m, scanner.Err()
+}
+
+// Line returns the line the instruction at addr was assembled from.
+func (m *LineMap) Line(addr uint16) (int, bool) {
+	line, ok := m.Lines[addr]
+	return line, ok
+}
+
+// Addr returns the address of the first instruction assembled from line, or from the closest line after
+// it when line has no instruction, along with that line.
+func (m *LineMap) Addr(line int) (uint16, int, bool) {
+	var best uint16
+	bestLine := 0
+	for _, addr := range m.addresses() {
+		l := m.Lines[addr]
+		if l < line {
+			continue
+		}
+		if bestLine == 0 || l < bestLine {
+			best, bestLine = addr, l
+		}
+	}
+	return best, bestLine, bestLine != 0
+}
+
+func (m *LineMap) addresses() []uint16 {
+	addrs := make([]uint16, 0, len(m.Lines))
+	for addr := range m.Lines {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
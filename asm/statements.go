@@ -0,0 +1,658 @@
+package asm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// keywords cannot be used as names.
+var keywords = map[string]bool{
+	"clear": true, "return": true, ";": true, "exit": true, "hires": true, "lores": true,
+	"scroll-down": true, "scroll-up": true, "scroll-left": true, "scroll-right": true,
+	"audio": true, "plane": true, "jump": true, "jump0": true, "bcd": true, "save": true, "load": true,
+	"saveflags": true, "loadflags": true, "sprite": true, "delay": true, "buzzer": true, "pitch": true,
+	"i": true, "if": true, "then": true, "begin": true, "else": true, "end": true, "loop": true,
+	"again": true, "while": true, "key": true, "-key": true, "random": true, "hex": true,
+	"bighex": true, "long": true,
+}
+
+// statement assembles the statement starting at the next token.
+func (a *assembler) statement() error {
+	tok, err := a.next()
+	if err != nil {
+		return err
+	}
+	a.line = tok.at
+
+	if m, ok := a.macros[tok.text]; ok {
+		return a.expand(tok, m)
+	}
+	if x, ok := a.register(tok.text); ok {
+		return a.registerStatement(x)
+	}
+
+	switch tok.text {
+	case ":":
+		return a.defineLabel()
+	case ":alias":
+		return a.defineAlias()
+	case ":const":
+		return a.defineConst()
+	case ":macro":
+		return a.defineMacro()
+	case ":org":
+		addr, err := a.number(0, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		if addr < Origin {
+			return a.errorf(a.tokens[a.pos-1], "cannot :org below 0x%03X", Origin)
+		}
+		a.here = addr
+		return nil
+	case ":byte":
+		v, err := a.number(-128, 255)
+		if err != nil {
+			return err
+		}
+		return a.emit(byte(v))
+	case ":call":
+		return a.jump(0x2000)
+	case "jump":
+		return a.jump(0x1000)
+	case "jump0":
+		return a.jump(0xB000)
+	case "clear":
+		return a.emitOp(0x00E0)
+	case "return", ";":
+		return a.emitOp(0x00EE)
+	case "scroll-right":
+		return a.emitOp(0x00FB)
+	case "scroll-left":
+		return a.emitOp(0x00FC)
+	case "exit":
+		return a.emitOp(0x00FD)
+	case "lores":
+		return a.emitOp(0x00FE)
+	case "hires":
+		return a.emitOp(0x00FF)
+	case "audio":
+		return a.emitOp(0xF002)
+	case "scroll-down", "scroll-up":
+		n, err := a.number(0, 15)
+		if err != nil {
+			return err
+		}
+		if tok.text == "scroll-down" {
+			return a.emitOp(0x00C0 | uint16(n))
+		}
+		return a.emitOp(0x00D0 | uint16(n))
+	case "plane":
+		n, err := a.number(0, 3)
+		if err != nil {
+			return err
+		}
+		return a.emitOp(0xF001 | uint16(n)<<8)
+	case "bcd":
+		return a.registerOp(0xF033)
+	case "saveflags":
+		return a.registerOp(0xF075)
+	case "loadflags":
+		return a.registerOp(0xF085)
+	case "save", "load":
+		x, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		if a.peek() != "-" {
+			if tok.text == "save" {
+				return a.emitOp(0xF055 | uint16(x)<<8)
+			}
+			return a.emitOp(0xF065 | uint16(x)<<8)
+		}
+		a.pos++
+		y, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		if tok.text == "save" {
+			return a.emitOp(0x5002 | uint16(x)<<8 | uint16(y)<<4)
+		}
+		return a.emitOp(0x5003 | uint16(x)<<8 | uint16(y)<<4)
+	case "sprite":
+		x, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		y, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		n, err := a.number(0, 15)
+		if err != nil {
+			return err
+		}
+		return a.emitOp(0xD000 | uint16(x)<<8 | uint16(y)<<4 | uint16(n))
+	case "delay", "buzzer", "pitch":
+		if err := a.expect(":="); err != nil {
+			return err
+		}
+		op := map[string]uint16{"delay": 0xF015, "buzzer": 0xF018, "pitch": 0xF03A}[tok.text]
+		return a.registerOp(op)
+	case "i":
+		return a.iStatement()
+	case "if":
+		return a.ifStatement(tok)
+	case "else":
+		return a.elseStatement(tok)
+	case "end":
+		return a.endStatement(tok)
+	case "loop":
+		a.blocks = append(a.blocks, block{tok: tok, addr: a.here})
+		return nil
+	case "while":
+		return a.whileStatement(tok)
+	case "again":
+		return a.againStatement(tok)
+	}
+
+	if v, ok, err := a.value(tok); ok || err != nil {
+		if err != nil {
+			return err
+		}
+		if v < -128 || v > 255 {
+			return a.errorf(tok, "%d does not fit in a byte", v)
+		}
+		return a.emit(byte(v))
+	}
+	if !isName(tok.text) || keywords[tok.text] {
+		return a.errorf(tok, "unexpected %q", tok.text)
+	}
+	// Octo calls a subroutine by naming it.
+	a.pos--
+	return a.jump(0x2000)
+}
+
+func (a *assembler) defineLabel() error {
+	tok, err := a.name()
+	if err != nil {
+		return err
+	}
+	if _, ok := a.labels[tok.text]; ok {
+		return a.errorf(tok, "label %q is already defined", tok.text)
+	}
+	// The jump to main is left out when main comes first.
+	if tok.text == "main" && a.mainJump && a.here == Origin+2 && a.end == Origin+2 {
+		a.mainJump = false
+		a.here, a.end = Origin, Origin
+	}
+	a.labels[tok.text] = uint16(a.here)
+	return nil
+}
+
+func (a *assembler) defineAlias() error {
+	tok, err := a.name()
+	if err != nil {
+		return err
+	}
+	x, err := a.nextRegister()
+	if err != nil {
+		return err
+	}
+	a.aliases[tok.text] = x
+	return nil
+}
+
+func (a *assembler) defineConst() error {
+	tok, err := a.name()
+	if err != nil {
+		return err
+	}
+	v, err := a.number(-0x8000, 0xFFFF)
+	if err != nil {
+		return err
+	}
+	a.consts[tok.text] = v
+	return nil
+}
+
+// defineMacro reads ":macro name args... { body }".
+func (a *assembler) defineMacro() error {
+	tok, err := a.name()
+	if err != nil {
+		return err
+	}
+	var m macro
+	for {
+		arg, err := a.next()
+		if err != nil {
+			return err
+		}
+		if arg.text == "{" {
+			break
+		}
+		m.args = append(m.args, arg.text)
+	}
+	depth := 1
+	for {
+		t, err := a.next()
+		if err != nil {
+			return err
+		}
+		switch t.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+		m.body = append(m.body, t)
+	}
+	a.macros[tok.text] = m
+	return nil
+}
+
+// expand replaces the invocation of a macro with its body, in which the arguments are substituted.
+func (a *assembler) expand(tok token, m macro) error {
+	a.expansions++
+	if a.expansions > maxExpansions {
+		return a.errorf(tok, "too many macro expansions, is %q recursive?", tok.text)
+	}
+	args := map[string]string{}
+	for _, name := range m.args {
+		arg, err := a.next()
+		if err != nil {
+			return err
+		}
+		args[name] = arg.text
+	}
+	body := make([]token, len(m.body))
+	for i, t := range m.body {
+		if arg, ok := args[t.text]; ok {
+			t.text = arg
+		}
+		t.at = tok.at
+		body[i] = t
+	}
+	rest := append(body, a.tokens[a.pos:]...)
+	a.tokens = append(a.tokens[:a.pos:a.pos], rest...)
+	return nil
+}
+
+// name reads the name of a label, an alias, a constant or a macro.
+func (a *assembler) name() (token, error) {
+	tok, err := a.next()
+	if err != nil {
+		return tok, err
+	}
+	if _, ok := a.register(tok.text); ok || keywords[tok.text] || !isName(tok.text) {
+		return tok, a.errorf(tok, "%q cannot be used as a name", tok.text)
+	}
+	return tok, nil
+}
+
+// isName reports whether text starts like a name rather than a number or an operator.
+func isName(text string) bool {
+	c := text[0]
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// register returns the number of the register named text, either v0 to vf or an alias.
+func (a *assembler) register(text string) (uint8, bool) {
+	if x, ok := a.aliases[text]; ok {
+		return x, true
+	}
+	if len(text) == 2 && (text[0] == 'v' || text[0] == 'V') {
+		if x, err := strconv.ParseUint(text[1:], 16, 8); err == nil {
+			return uint8(x), true
+		}
+	}
+	return 0, false
+}
+
+func (a *assembler) nextRegister() (uint8, error) {
+	tok, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	x, ok := a.register(tok.text)
+	if !ok {
+		return 0, a.errorf(tok, "expected a register, found %q", tok.text)
+	}
+	return x, nil
+}
+
+// registerOp emits op with the next register as x.
+func (a *assembler) registerOp(op uint16) error {
+	x, err := a.nextRegister()
+	if err != nil {
+		return err
+	}
+	return a.emitOp(op | uint16(x)<<8)
+}
+
+func parseNumber(text string) (int, error) {
+	v, err := strconv.ParseInt(text, 0, 32)
+	return int(v), err
+}
+
+// value returns the value of a number or a constant. ok is false when tok is neither.
+func (a *assembler) value(tok token) (v int, ok bool, err error) {
+	if v, ok := a.consts[tok.text]; ok {
+		return v, true, nil
+	}
+	c := tok.text
+	if strings.HasPrefix(c, "-") || strings.HasPrefix(c, "+") {
+		c = c[1:]
+	}
+	if c == "" || c[0] < '0' || c[0] > '9' {
+		return 0, false, nil
+	}
+	v, err = parseNumber(tok.text)
+	if err != nil {
+		return 0, true, a.errorf(tok, "invalid number %q", tok.text)
+	}
+	return v, true, nil
+}
+
+// number reads a number or a constant between min and max.
+func (a *assembler) number(min, max int) (int, error) {
+	tok, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	v, ok, err := a.value(tok)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, a.errorf(tok, "expected a number, found %q", tok.text)
+	}
+	if v < min || v > max {
+		return 0, a.errorf(tok, "%d is out of range [%d, %d]", v, min, max)
+	}
+	return v, nil
+}
+
+// byteValue reads a number which fits in a byte, negative numbers being stored in two's complement.
+func (a *assembler) byteValue() (uint16, error) {
+	v, err := a.number(-128, 255)
+	return uint16(v) & 0xFF, err
+}
+
+// address reads the address of a label, or a number, and returns it. A label defined later is
+// resolved once the whole source is assembled, into the instruction at the current address.
+func (a *assembler) address(long bool) (int, error) {
+	tok, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	max := 0xFFF
+	if long {
+		max = 0xFFFF
+	}
+	if addr, ok := a.labels[tok.text]; ok {
+		if int(addr) > max {
+			return 0, a.errorf(tok, "label %q is at 0x%04X, beyond the 12 bits addresses; use i := long", tok.text, addr)
+		}
+		return int(addr), nil
+	}
+	v, ok, err := a.value(tok)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		if v < 0 || v > max {
+			return 0, a.errorf(tok, "address 0x%X is out of range", v)
+		}
+		return v, nil
+	}
+	if _, ok := a.register(tok.text); ok || keywords[tok.text] || !isName(tok.text) {
+		return 0, a.errorf(tok, "expected an address, found %q", tok.text)
+	}
+	f := fixup{tok: tok, addr: a.here, long: long}
+	if long {
+		f.addr += 2
+	}
+	a.fixups = append(a.fixups, f)
+	return 0, nil
+}
+
+// jump emits op with the next address as nnn.
+func (a *assembler) jump(op uint16) error {
+	addr, err := a.address(false)
+	if err != nil {
+		return err
+	}
+	return a.emitOp(op | uint16(addr))
+}
+
+// registerStatement assembles the statements starting with the register vx.
+func (a *assembler) registerStatement(x uint8) error {
+	opTok, err := a.next()
+	if err != nil {
+		return err
+	}
+	vx := uint16(x) << 8
+	rhs, err := a.next()
+	if err != nil {
+		return err
+	}
+	y, isReg := a.register(rhs.text)
+	vy := uint16(y) << 4
+
+	// The operations between registers.
+	regOps := map[string]uint16{
+		":=": 0x8000, "|=": 0x8001, "&=": 0x8002, "^=": 0x8003, "+=": 0x8004,
+		"-=": 0x8005, ">>=": 0x8006, "=-": 0x8007, "<<=": 0x800E,
+	}
+	if op, ok := regOps[opTok.text]; ok && isReg {
+		return a.emitOp(op | vx | vy)
+	} else if !ok {
+		return a.errorf(opTok, "unknown operator %q", opTok.text)
+	}
+
+	switch opTok.text {
+	case ":=":
+		switch rhs.text {
+		case "random":
+			kk, err := a.byteValue()
+			if err != nil {
+				return err
+			}
+			return a.emitOp(0xC000 | vx | kk)
+		case "key":
+			return a.emitOp(0xF00A | vx)
+		case "delay":
+			return a.emitOp(0xF007 | vx)
+		}
+		a.pos--
+		kk, err := a.byteValue()
+		if err != nil {
+			return err
+		}
+		return a.emitOp(0x6000 | vx | kk)
+	case "+=", "-=":
+		a.pos--
+		kk, err := a.byteValue()
+		if err != nil {
+			return err
+		}
+		if opTok.text == "-=" {
+			kk = -kk & 0xFF
+		}
+		return a.emitOp(0x7000 | vx | kk)
+	}
+	return a.errorf(rhs, "expected a register, found %q", rhs.text)
+}
+
+// iStatement assembles the statements starting with i.
+func (a *assembler) iStatement() error {
+	opTok, err := a.next()
+	if err != nil {
+		return err
+	}
+	switch opTok.text {
+	case "+=":
+		return a.registerOp(0xF01E)
+	case ":=":
+	default:
+		return a.errorf(opTok, "unknown operator %q", opTok.text)
+	}
+	switch a.peek() {
+	case "hex":
+		a.pos++
+		return a.registerOp(0xF029)
+	case "bighex":
+		a.pos++
+		return a.registerOp(0xF030)
+	case "long":
+		a.pos++
+		addr, err := a.address(true)
+		if err != nil {
+			return err
+		}
+		if err := a.emitOp(0xF000); err != nil {
+			return err
+		}
+		return a.emit(byte(addr>>8), byte(addr))
+	}
+	return a.jump(0xA000)
+}
+
+// condition reads "vx == n", "vx != vy", "vx key", etc. and returns the skip instructions skipping the next
+// instruction when the condition is true and when it is false.
+func (a *assembler) condition() (skipIfTrue, skipIfFalse uint16, err error) {
+	x, err := a.nextRegister()
+	if err != nil {
+		return 0, 0, err
+	}
+	vx := uint16(x) << 8
+	opTok, err := a.next()
+	if err != nil {
+		return 0, 0, err
+	}
+	switch opTok.text {
+	case "key":
+		return 0xE09E | vx, 0xE0A1 | vx, nil
+	case "-key":
+		return 0xE0A1 | vx, 0xE09E | vx, nil
+	case "==", "!=":
+	case "<", ">", "<=", ">=":
+		return 0, 0, a.errorf(opTok, "comparison %q is not supported, use == or !=", opTok.text)
+	default:
+		return 0, 0, a.errorf(opTok, "unknown comparison %q", opTok.text)
+	}
+
+	var eq, ne uint16
+	if y, ok := a.register(a.peek()); ok {
+		a.pos++
+		eq, ne = 0x5000|vx|uint16(y)<<4, 0x9000|vx|uint16(y)<<4
+	} else {
+		kk, err := a.byteValue()
+		if err != nil {
+			return 0, 0, err
+		}
+		eq, ne = 0x3000|vx|kk, 0x4000|vx|kk
+	}
+	if opTok.text == "==" {
+		return eq, ne, nil
+	}
+	return ne, eq, nil
+}
+
+func (a *assembler) ifStatement(tok token) error {
+	skipIfTrue, skipIfFalse, err := a.condition()
+	if err != nil {
+		return err
+	}
+	next, err := a.next()
+	if err != nil {
+		return err
+	}
+	switch next.text {
+	case "then":
+		return a.emitOp(skipIfFalse)
+	case "begin":
+		// The body is jumped over unless the condition is true.
+		if err := a.emitOp(skipIfTrue); err != nil {
+			return err
+		}
+		a.blocks = append(a.blocks, block{tok: next, addr: a.here})
+		return a.emitOp(0x1000)
+	}
+	return a.errorf(next, "expected then or begin, found %q", next.text)
+}
+
+func (a *assembler) elseStatement(tok token) error {
+	if len(a.blocks) == 0 || a.blocks[len(a.blocks)-1].tok.text != "begin" {
+		return a.errorf(tok, "else without if ... begin")
+	}
+	b := &a.blocks[len(a.blocks)-1]
+	jump := a.here
+	if err := a.emitOp(0x1000); err != nil {
+		return err
+	}
+	if err := a.patch(tok, b.addr, a.here); err != nil {
+		return err
+	}
+	b.tok, b.addr = tok, jump
+	return nil
+}
+
+func (a *assembler) endStatement(tok token) error {
+	if len(a.blocks) == 0 || a.blocks[len(a.blocks)-1].tok.text == "loop" {
+		return a.errorf(tok, "end without if ... begin")
+	}
+	b := a.blocks[len(a.blocks)-1]
+	a.blocks = a.blocks[:len(a.blocks)-1]
+	return a.patch(tok, b.addr, a.here)
+}
+
+// innerLoop returns the innermost open loop.
+func (a *assembler) innerLoop() *block {
+	for i := len(a.blocks) - 1; i >= 0; i-- {
+		if a.blocks[i].tok.text == "loop" {
+			return &a.blocks[i]
+		}
+	}
+	return nil
+}
+
+func (a *assembler) whileStatement(tok token) error {
+	l := a.innerLoop()
+	if l == nil {
+		return a.errorf(tok, "while outside of a loop")
+	}
+	skipIfTrue, _, err := a.condition()
+	if err != nil {
+		return err
+	}
+	if err := a.emitOp(skipIfTrue); err != nil {
+		return err
+	}
+	l.whiles = append(l.whiles, a.here)
+	return a.emitOp(0x1000)
+}
+
+func (a *assembler) againStatement(tok token) error {
+	if len(a.blocks) == 0 || a.blocks[len(a.blocks)-1].tok.text != "loop" {
+		return a.errorf(tok, "again without loop")
+	}
+	l := a.blocks[len(a.blocks)-1]
+	a.blocks = a.blocks[:len(a.blocks)-1]
+	if err := a.emitOp(0x1000); err != nil {
+		return err
+	}
+	if err := a.patch(tok, a.here-2, l.addr); err != nil {
+		return err
+	}
+	for _, addr := range l.whiles {
+		if err := a.patch(tok, addr, a.here); err != nil {
+			return err
+		}
+	}
+	return nil
+}
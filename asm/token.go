@@ -0,0 +1,38 @@
+package asm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// token is a word of the source. Octo words are separated by white space, and comments run from # to
+// the end of the line.
+type token struct {
+	text      string
+	line, col int
+	// at is the line the token is assembled for: its own line, or the line of the macro invocation it
+	// was expanded from.
+	at int
+}
+
+func tokenize(src string) []token {
+	var tokens []token
+	for i, line := range strings.Split(src, "\n") {
+		runes := []rune(line)
+		for col := 0; col < len(runes); {
+			switch {
+			case runes[col] == '#':
+				col = len(runes)
+			case unicode.IsSpace(runes[col]):
+				col++
+			default:
+				start := col
+				for col < len(runes) && !unicode.IsSpace(runes[col]) && runes[col] != '#' {
+					col++
+				}
+				tokens = append(tokens, token{text: string(runes[start:col]), line: i + 1, col: start + 1, at: i + 1})
+			}
+		}
+	}
+	return tokens
+}
@@ -1,71 +1,222 @@
 package chip8
 
-import "C"
 import (
+	"fmt"
 	"math"
-
-	"github.com/gordonklaus/portaudio"
+	"sync"
 )
 
-const sampleRate = 44100
+// SampleRate is the number of samples per second the audio sinks play.
+const SampleRate = 44100
 
-func NewAudioController() *AudioController {
-	portaudio.Initialize()
-	s := newStereoSine(256, 320, sampleRate)
-	return &AudioController{
-		stereoSine: s,
-	}
+// AudioSink plays the buzzer of the CPU: a tone sounding while the sound timer is running, or the XO-CHIP
+// audio pattern once one is loaded.
+type AudioSink interface {
+	// Start turns the tone on. It is called every frame while the sound timer is running.
+	Start() error
+	// Stop turns the tone off. It is called every frame while the sound timer is not running, and once
+	// when the CPU pauses while the buzzer sounds.
+	Stop() error
+	// SetPattern makes the buzzer play the 128 bits of the XO-CHIP audio pattern instead of the tone.
+	SetPattern(pattern [16]uint8)
+	// ClearPattern makes the buzzer play the tone again, as before any audio pattern was loaded.
+	ClearPattern()
+	// SetPitch sets the rate the XO-CHIP audio pattern is played at.
+	SetPitch(pitch uint8)
+	// Close releases the device, or completes the file, the sink plays to.
+	Close() error
 }
 
-type AudioController struct {
-	stereoSine *stereoSine
-	isOn       bool
+// Waveform is the shape of the tone of the buzzer.
+type Waveform int
+
+const (
+	Square Waveform = iota
+	Sine
+	Triangle
+)
+
+// Waveforms are the waveforms by name, as given on the command line.
+var Waveforms = map[string]Waveform{
+	"square":   Square,
+	"sine":     Sine,
+	"triangle": Triangle,
 }
 
-func (a *AudioController) Destroy() {
-	portaudio.Terminate()
-	a.stereoSine.Close()
+// ToneConfig configures the tone of the buzzer.
+type ToneConfig struct {
+	Waveform Waveform
+	// Frequency is the frequency of the tone in Hz.
+	Frequency float64
+	// Volume is the amplitude of the samples, from 0 to 1.
+	Volume float64
 }
 
-func (a *AudioController) Start() {
-	if !a.isOn {
-		a.isOn = true
-		chk(a.stereoSine.Start())
+// defaultPitch is the XO-CHIP pitch before any Fx3A, playing the audio pattern at 4000 bits per second.
+const defaultPitch = 64
+
+// DefaultTone is a square wave at 440Hz, at a quarter of the full volume.
+var DefaultTone = ToneConfig{Waveform: Square, Frequency: 440, Volume: 0.25}
+
+func (config ToneConfig) validate() error {
+	if config.Frequency <= 0 || config.Frequency >= SampleRate/2 {
+		return fmt.Errorf("tone frequency %gHz out of range", config.Frequency)
 	}
+	if config.Volume < 0 || config.Volume > 1 {
+		return fmt.Errorf("volume %g out of range, it goes from 0 to 1", config.Volume)
+	}
+	return nil
+}
+
+// Tone generates the samples of the buzzer, shared by the audio sinks. It is silent while off.
+type Tone struct {
+	mu     sync.Mutex
+	config ToneConfig
+	on     bool
+	step   float64
+	phase  float64
+
+	hasPattern   bool
+	pattern      [16]uint8
+	patternStep  float64
+	patternPhase float64
 }
 
-func (a *AudioController) Stop() {
-	if a.isOn {
-		a.isOn = false
-		chk(a.stereoSine.Stop())
+// NewTone returns a Tone playing config, initially off.
+func NewTone(config ToneConfig) (*Tone, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
 	}
+	t := &Tone{config: config, step: config.Frequency / SampleRate}
+	t.SetPitch(defaultPitch)
+	return t, nil
 }
 
-type stereoSine struct {
-	*portaudio.Stream
-	stepL, phaseL float64
-	stepR, phaseR float64
+// SetOn turns the tone on or off.
+func (t *Tone) SetOn(on bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.on = on
 }
 
-func newStereoSine(freqL, freqR, sampleRate float64) *stereoSine {
-	s := &stereoSine{nil, freqL / sampleRate, 0, freqR / sampleRate, 0}
-	var err error
-	s.Stream, err = portaudio.OpenDefaultStream(0, 2, sampleRate, 0, s.processAudio)
-	chk(err)
-	return s
+// On reports whether the tone is on.
+func (t *Tone) On() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.on
 }
 
-func (g *stereoSine) processAudio(out [][]float32) {
-	for i := range out[0] {
-		out[0][i] = float32(math.Sin(2 * math.Pi * g.phaseL))
-		_, g.phaseL = math.Modf(g.phaseL + g.stepL)
-		out[1][i] = float32(math.Sin(2 * math.Pi * g.phaseR))
-		_, g.phaseR = math.Modf(g.phaseR + g.stepR)
+// SetPattern makes the tone play the 128 bits of the XO-CHIP audio pattern instead of the waveform.
+func (t *Tone) SetPattern(pattern [16]uint8) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hasPattern = true
+	t.pattern = pattern
+}
+
+// ClearPattern makes the tone play the waveform again.
+func (t *Tone) ClearPattern() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hasPattern = false
+}
+
+// SetPitch sets the rate the XO-CHIP audio pattern is played at.
+// The pattern is played at 4000*2^((pitch-64)/48) bits per second.
+func (t *Tone) SetPitch(pitch uint8) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rate := 4000 * math.Pow(2, (float64(pitch)-64)/48)
+	t.patternStep = rate / SampleRate
+}
+
+// Generate fills out with the next samples, played at SampleRate on a single channel.
+func (t *Tone) Generate(out []float32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.on {
+		for i := range out {
+			out[i] = 0
+		}
+		return
+	}
+	volume := float32(t.config.Volume)
+	if t.hasPattern {
+		for i := range out {
+			bit := int(t.patternPhase)
+			sample := -volume
+			if t.pattern[bit/8]&(0x80>>(bit%8)) != 0 {
+				sample = volume
+			}
+			out[i] = sample
+			t.patternPhase = math.Mod(t.patternPhase+t.patternStep, 128)
+		}
+		return
+	}
+	for i := range out {
+		out[i] = volume * float32(t.wave(t.phase))
+		_, t.phase = math.Modf(t.phase + t.step)
 	}
 }
 
-func chk(err error) {
-	if err != nil {
-		panic(err)
+// wave returns the value of the waveform, from -1 to 1, at phase, from 0 to 1.
+func (t *Tone) wave(phase float64) float64 {
+	switch t.config.Waveform {
+	case Sine:
+		return math.Sin(2 * math.Pi * phase)
+	case Triangle:
+		return 4*math.Abs(phase-0.5) - 1
+	}
+	if phase < 0.5 {
+		return 1
 	}
+	return -1
+}
+
+// NullAudioSink plays nothing, only keeping track of whether the buzzer is on. It is meant for headless runs.
+type NullAudioSink struct {
+	sync.Mutex
+	on bool
+}
+
+// NewNullAudioSink returns a NullAudioSink with the buzzer off.
+func NewNullAudioSink() *NullAudioSink {
+	return &NullAudioSink{}
+}
+
+// Start turns the buzzer on.
+func (n *NullAudioSink) Start() error {
+	n.Lock()
+	defer n.Unlock()
+	n.on = true
+	return nil
+}
+
+// Stop turns the buzzer off.
+func (n *NullAudioSink) Stop() error {
+	n.Lock()
+	defer n.Unlock()
+	n.on = false
+	return nil
+}
+
+// SetPattern does nothing, since no sound is played.
+func (n *NullAudioSink) SetPattern(pattern [16]uint8) {}
+
+// ClearPattern does nothing, since no sound is played.
+func (n *NullAudioSink) ClearPattern() {}
+
+// SetPitch does nothing, since no sound is played.
+func (n *NullAudioSink) SetPitch(pitch uint8) {}
+
+// Close does nothing, there is no device to release.
+func (n *NullAudioSink) Close() error {
+	return nil
+}
+
+// IsOn reports whether the buzzer is sounding.
+func (n *NullAudioSink) IsOn() bool {
+	n.Lock()
+	defer n.Unlock()
+	return n.on
 }
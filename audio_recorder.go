@@ -0,0 +1,83 @@
+package chip8
+
+import (
+	"io"
+	"sync"
+)
+
+// samplesPerFrame is the number of samples of a tick of the 60Hz timer.
+const samplesPerFrame = SampleRate / timerFrequency
+
+// AudioRecorder records the buzzer of a CPU to a WAV file, at the resolution of the 60Hz timer: every call
+// to Tick renders a frame of the tone, or of the XO-CHIP audio pattern, or of silence. The file follows the
+// emulated time, so it can be recorded headless, or faster than real time.
+type AudioRecorder struct {
+	cpu  *CPU
+	tone *Tone
+
+	mu     sync.Mutex
+	wav    *wavWriter
+	frames int
+	closed bool
+	err    error
+}
+
+// NewAudioRecorder returns an AudioRecorder of the buzzer of cpu writing to w with the tone of config.
+// Tick must then be called at every tick of the timer, e.g. from Hooks.Tick.
+func NewAudioRecorder(cpu *CPU, w io.WriteSeeker, config ToneConfig) (*AudioRecorder, error) {
+	tone, err := NewTone(config)
+	if err != nil {
+		return nil, err
+	}
+	wav, err := newWAVWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &AudioRecorder{cpu: cpu, tone: tone, wav: wav}, nil
+}
+
+// Frames returns the number of frames recorded.
+func (r *AudioRecorder) Frames() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.frames
+}
+
+// Tick renders the frame of the tick of the timer which just happened. It must be called while the state
+// of the CPU is locked, as Hooks.Tick is.
+func (r *AudioRecorder) Tick() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.err != nil {
+		return
+	}
+	c := r.cpu
+	if c.hasPattern {
+		r.tone.SetPattern(c.pattern)
+	} else {
+		r.tone.ClearPattern()
+	}
+	r.tone.SetPitch(c.pitch)
+	r.tone.SetOn(c.buzzing)
+
+	var samples [samplesPerFrame]float32
+	r.tone.Generate(samples[:])
+	if r.err = r.wav.writeSamples(samples[:]); r.err == nil {
+		r.frames++
+	}
+}
+
+// Close completes the file, and closes the writer when it is an io.Closer. The ticks after it are not
+// recorded. It returns the first error writing the file.
+func (r *AudioRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return r.err
+	}
+	r.closed = true
+	if err := r.wav.close(); r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
@@ -0,0 +1,171 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// wavHeaderSize is the size of the RIFF header of a WAV file with a single data chunk.
+const wavHeaderSize = 44
+
+// wavWriter writes 16-bit mono PCM samples at SampleRate to a WAV file.
+type wavWriter struct {
+	w       io.WriteSeeker
+	written int
+}
+
+func newWAVWriter(w io.WriteSeeker) (*wavWriter, error) {
+	ww := &wavWriter{w: w}
+	if err := ww.writeHeader(); err != nil {
+		return nil, err
+	}
+	return ww, nil
+}
+
+// writeHeader writes the header for the samples written so far.
+func (ww *wavWriter) writeHeader() error {
+	const channels, bitsPerSample = 1, 16
+	dataSize := uint32(2 * ww.written)
+	h := make([]byte, 0, wavHeaderSize)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, wavHeaderSize-8+dataSize)
+	h = append(h, "WAVEfmt "...)
+	h = binary.LittleEndian.AppendUint32(h, 16)
+	h = binary.LittleEndian.AppendUint16(h, 1) // PCM
+	h = binary.LittleEndian.AppendUint16(h, channels)
+	h = binary.LittleEndian.AppendUint32(h, SampleRate)
+	h = binary.LittleEndian.AppendUint32(h, SampleRate*channels*bitsPerSample/8)
+	h = binary.LittleEndian.AppendUint16(h, channels*bitsPerSample/8)
+	h = binary.LittleEndian.AppendUint16(h, bitsPerSample)
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, dataSize)
+	if _, err := ww.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ww.w.Write(h); err != nil {
+		return err
+	}
+	_, err := ww.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (ww *wavWriter) writeSamples(samples []float32) error {
+	buf := make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(buf[2*i:], uint16(int16(math.Round(float64(sample)*math.MaxInt16))))
+	}
+	if _, err := ww.w.Write(buf); err != nil {
+		return err
+	}
+	ww.written += len(samples)
+	return nil
+}
+
+// close completes the header, and closes the file when it is an io.Closer.
+func (ww *wavWriter) close() error {
+	err := ww.writeHeader()
+	if c, ok := ww.w.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// WAVSink writes the sound of the buzzer to a WAV file, as 16-bit mono samples at SampleRate. The samples
+// are generated in real time, so the file lasts as long as the sink is open. AudioRecorder records the
+// emulated time instead.
+type WAVSink struct {
+	*Tone
+	start time.Time
+	done  chan struct{}
+	wg    sync.WaitGroup
+
+	mu  sync.Mutex
+	wav *wavWriter
+	err error
+}
+
+// NewWAVSink writes the header of the file to w and starts recording. Close completes the header, and
+// closes w when it is an io.Closer.
+func NewWAVSink(w io.WriteSeeker, config ToneConfig) (*WAVSink, error) {
+	tone, err := NewTone(config)
+	if err != nil {
+		return nil, err
+	}
+	wav, err := newWAVWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	s := &WAVSink{Tone: tone, wav: wav, start: time.Now(), done: make(chan struct{})}
+	s.wg.Add(1)
+	go s.record()
+	return s, nil
+}
+
+// record writes the samples due since the start until the sink is closed.
+func (s *WAVSink) record() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.catchUp(time.Now()); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// catchUp writes the samples due at now.
+func (s *WAVSink) catchUp(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	n := int(now.Sub(s.start).Seconds()*SampleRate) - s.wav.written
+	if n <= 0 {
+		return nil
+	}
+	samples := make([]float32, n)
+	s.Generate(samples)
+	s.err = s.wav.writeSamples(samples)
+	return s.err
+}
+
+// failure returns the error which stopped the recording, if any.
+func (s *WAVSink) failure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *WAVSink) Start() error {
+	s.SetOn(true)
+	return s.failure()
+}
+
+func (s *WAVSink) Stop() error {
+	s.SetOn(false)
+	return s.failure()
+}
+
+// Close writes the last samples and completes the file.
+func (s *WAVSink) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	err := s.catchUp(time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cerr := s.wav.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
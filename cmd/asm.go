@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imrenagi/chip8/asm"
+)
+
+// runAsm implements "chip8 asm [flags] SOURCE", which assembles an Octo source into a ROM, its symbol map and
+// its line map.
+func runAsm(args []string) error {
+	fs := flag.NewFlagSet("asm", flag.ExitOnError)
+	out := fs.String("o", "", "path of the ROM (default: the source with the .ch8 extension)")
+	symbols := fs.String("sym", "", "path of the symbol map (default: the ROM with the .sym extension)")
+	lines := fs.String("lines", "", "path of the line map (default: the ROM with the .lines extension)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s asm [flags] SOURCE\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	source := fs.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(source, filepath.Ext(source)) + ".ch8"
+	}
+	if *symbols == "" {
+		*symbols = strings.TrimSuffix(*out, filepath.Ext(*out)) + ".sym"
+	}
+	if *lines == "" {
+		*lines = strings.TrimSuffix(*out, filepath.Ext(*out)) + ".lines"
+	}
+
+	src, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	program, err := asm.Assemble(source, src)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, program.Bytes, 0644); err != nil {
+		return err
+	}
+	if err := writeFile(*symbols, program.WriteSymbols); err != nil {
+		return err
+	}
+	// The source is named by its absolute path, so that the line map can be used from any directory.
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	return writeFile(*lines, program.LineMap(abs).Write)
+}
+
+// writeFile creates the file at path and writes it with write.
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/portaudio"
+	"github.com/imrenagi/chip8/sdlui"
+)
+
+// toneFlags are the flags setting the tone of the buzzer.
+type toneFlags struct {
+	waveform  *string
+	frequency *float64
+	volume    *float64
+}
+
+func addToneFlags(fs *flag.FlagSet) toneFlags {
+	return toneFlags{
+		waveform:  fs.String("waveform", "square", "waveform of the buzzer: square, sine or triangle"),
+		frequency: fs.Float64("tone", chip8.DefaultTone.Frequency, "frequency of the buzzer in Hz"),
+		volume:    fs.Float64("volume", chip8.DefaultTone.Volume, "volume of the buzzer, from 0 to 1"),
+	}
+}
+
+func (f toneFlags) config() (chip8.ToneConfig, error) {
+	waveform, ok := chip8.Waveforms[*f.waveform]
+	if !ok {
+		return chip8.ToneConfig{}, fmt.Errorf("unknown waveform %q", *f.waveform)
+	}
+	return chip8.ToneConfig{Waveform: waveform, Frequency: *f.frequency, Volume: *f.volume}, nil
+}
+
+// audioFlags are the flags selecting the audio sink and the tone of the buzzer.
+type audioFlags struct {
+	toneFlags
+	backend *string
+}
+
+func addAudioFlags(fs *flag.FlagSet) audioFlags {
+	return audioFlags{
+		toneFlags: addToneFlags(fs),
+		backend:   fs.String("audio", "portaudio", "audio backend: portaudio, sdl, none or wav:FILE.wav"),
+	}
+}
+
+// sink opens the audio sink. SDL must be initialized for the sdl backend.
+func (f audioFlags) sink() (chip8.AudioSink, error) {
+	config, err := f.config()
+	if err != nil {
+		return nil, err
+	}
+	switch *f.backend {
+	case "portaudio":
+		return portaudio.NewSink(config)
+	case "sdl":
+		return sdlui.NewAudioSink(config)
+	case "none":
+		return chip8.NewNullAudioSink(), nil
+	}
+	if path := strings.TrimPrefix(*f.backend, "wav:"); path != *f.backend {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		sink, err := chip8.NewWAVSink(file, config)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return sink, nil
+	}
+	return nil, fmt.Errorf("unknown audio backend %q", *f.backend)
+}
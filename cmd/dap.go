@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/dap"
+	"github.com/imrenagi/chip8/sdlui"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// launch is a launch request of the debug adapter, handled on the main thread which owns the window.
+type launch struct {
+	path   string
+	quirks chip8.Quirks
+	cpu    chan *chip8.CPU
+	err    chan error
+}
+
+// runDAP serves the Debug Adapter Protocol on the standard input and output, or on a TCP address. The
+// emulator window opens when the client launches a program.
+func runDAP(args []string) error {
+	fs := flag.NewFlagSet("dap", flag.ExitOnError)
+	listen := fs.String("listen", "", "serve a single client on this address instead of the standard input and output, e.g. localhost:4711")
+	speed := fs.Int("speed", 500, "instructions executed per second")
+	keymapName := fs.String("keymap", "", "keymap: default, arrows or a JSON file (default: the program with the .keymap extension, if any)")
+	audioFlags := addAudioFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s dap [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	// The standard output carries the protocol.
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	var r io.Reader = os.Stdin
+	var w io.Writer = os.Stdout
+	if *listen != "" {
+		l, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("debug adapter listening on %s", l.Addr())
+		conn, err := l.Accept()
+		l.Close()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		r, w = conn, conn
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	launches := make(chan launch)
+	server := dap.NewServer(func(path string, quirks chip8.Quirks) (*chip8.CPU, error) {
+		l := launch{path: path, quirks: quirks, cpu: make(chan *chip8.CPU, 1), err: make(chan error, 1)}
+		select {
+		case launches <- l:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		select {
+		case c := <-l.cpu:
+			return c, nil
+		case err := <-l.err:
+			return nil, err
+		}
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, r, w)
+		cancel()
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case l := <-launches:
+		keymap, err := loadKeymap(*keymapName, l.path)
+		if err != nil {
+			l.err <- err
+			return <-served
+		}
+		if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
+			l.err <- err
+			return <-served
+		}
+		audio, err := audioFlags.sink()
+		if err != nil {
+			// The launch request fails, and the client ends the session.
+			l.err <- err
+			return <-served
+		}
+		window := sdlui.NewWindow()
+		display := chip8.NewDisplay(window)
+		keyboard := chip8.NewKeyboard()
+		c := chip8.NewCPU(&display, keyboard, audio, l.quirks)
+		c.SetSpeed(*speed)
+		l.cpu <- c
+
+		tone, _ := audioFlags.config()
+		keys := &hotkeys{cpu: c, rom: l.path, tone: tone, keymap: keymap, window: window}
+		eventLoop(ctx, c, keyboard, keys)
+		keys.close()
+		cancel()
+		return <-served
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/asm"
+	"github.com/imrenagi/chip8/debugger"
+	"github.com/imrenagi/chip8/gdb"
+	"github.com/rs/zerolog/log"
+)
+
+// startDebugger pauses the CPU and runs the debugger on the terminal. Quitting the debugger cancels the
+// context of the emulator.
+func startDebugger(c *chip8.CPU, rom, symbolsPath string, cancel context.CancelFunc) {
+	d := debugger.New(c, os.Stdout)
+
+	if symbolsPath == "" {
+		symbolsPath = strings.TrimSuffix(rom, filepath.Ext(rom)) + ".sym"
+		if _, err := os.Stat(symbolsPath); err != nil {
+			symbolsPath = ""
+		}
+	}
+	if symbolsPath != "" {
+		f, err := os.Open(symbolsPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to open the symbol map")
+		}
+		symbols, err := asm.ReadSymbols(f)
+		f.Close()
+		if err != nil {
+			log.Fatal().Err(err).Msgf("unable to read the symbol map %s", symbolsPath)
+		}
+		d.SetSymbols(symbols)
+	}
+
+	c.Pause()
+	go func() {
+		if err := d.Run(os.Stdin); err != nil {
+			log.Error().Err(err).Msg("debugger stopped")
+		}
+		cancel()
+	}()
+}
+
+// startGDBServer pauses the CPU until GDB attaches on addr. Killing the program from GDB cancels the context
+// of the emulator.
+func startGDBServer(ctx context.Context, c *chip8.CPU, addr string, cancel context.CancelFunc) {
+	server := gdb.NewServer(c)
+	c.Pause()
+	go func() {
+		err := server.ListenAndServe(ctx, addr)
+		if err != nil && !errors.Is(err, gdb.ErrKilled) {
+			log.Error().Err(err).Msg("gdb server stopped")
+		}
+		cancel()
+	}()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/imrenagi/chip8/disasm"
+)
+
+var styles = map[string]disasm.Style{
+	"octo":   disasm.Octo,
+	"cowgod": disasm.Cowgod,
+}
+
+// runDisasm implements "chip8 disasm [flags] ROM", which prints the listing of a ROM.
+func runDisasm(args []string) error {
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	styleName := fs.String("style", "octo", "syntax of the listing: octo or cowgod")
+	origin := fs.Uint("origin", 0x200, "address the ROM is loaded at")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s disasm [flags] ROM\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	style, ok := styles[*styleName]
+	if !ok {
+		return fmt.Errorf("unknown listing style %q", *styleName)
+	}
+	program, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return disasm.Disassemble(program, uint16(*origin)).WriteListing(os.Stdout, style)
+}
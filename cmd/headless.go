@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+
+	"github.com/imrenagi/chip8"
+)
+
+// runHeadless implements "chip8 headless [flags] ROM", which runs a ROM for a number of frames without a
+// window or a sound card, and writes what it produced: its audio, its display and a video of it.
+func runHeadless(args []string) error {
+	fs := flag.NewFlagSet("headless", flag.ExitOnError)
+	quirksName := fs.String("quirks", "legacy", "quirks profile: legacy, vip, chip48, schip, modern, octo or xochip")
+	frames := fs.Int("frames", 600, "number of frames of the 60Hz timer to run")
+	speed := fs.Int("speed", 500, "instructions executed per second")
+	seed := fs.Int64("seed", 1, "seed of the random numbers of RND")
+	wav := fs.String("wav", "", "record the buzzer to this WAV file")
+	screenshot := fs.String("screenshot", "", "write the display after the last frame to this PNG file")
+	scale := fs.Int("scale", windowScale, "size of the pixels of the 128x64 screen in the screenshot")
+	video := fs.String("video", "", "record the display to this animated GIF (.gif) or raw video (.y4m) file")
+	videoScale := fs.Int("video-scale", videoScale, "size of the pixels of the 128x64 screen in the video")
+	mux := fs.String("mux", "", "combine the -video and -wav recordings into this file with ffmpeg, e.g. out.mp4")
+	tone := addToneFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s headless [flags] ROM\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *frames < 0 || *speed < 1 || *scale < 1 || *videoScale < 1 ||
+		*mux != "" && (*video == "" || *wav == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	quirks, ok := chip8.QuirksPresets[*quirksName]
+	if !ok {
+		return fmt.Errorf("unknown quirks profile %q", *quirksName)
+	}
+	config, err := tone.config()
+	if err != nil {
+		return err
+	}
+
+	c := chip8.NewHeadlessCPU(quirks)
+	c.Rand = rand.New(rand.NewSource(*seed))
+	if err := c.LoadProgram(fs.Arg(0)); err != nil {
+		return err
+	}
+	// Both recorders are ticked by the CPU, so that they record the same frames.
+	var recorders []recorder
+	if *wav != "" {
+		f, err := os.Create(*wav)
+		if err != nil {
+			return err
+		}
+		recorder, err := chip8.NewAudioRecorder(c, f, config)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		recorders = append(recorders, recorder)
+	}
+	if *video != "" {
+		recorder, err := newVideoRecorder(c, *video, *videoScale)
+		if err != nil {
+			return err
+		}
+		recorders = append(recorders, recorder)
+	}
+	c.Hooks.Tick = func() {
+		for _, r := range recorders {
+			r.Tick()
+		}
+	}
+
+	runErr := runFrames(c, *frames, *speed)
+	for _, r := range recorders {
+		if err := r.Close(); err != nil {
+			return err
+		}
+	}
+	if err := c.Audio.Close(); err != nil {
+		return err
+	}
+	// The screenshot shows where the program failed too.
+	if *screenshot != "" {
+		if err := writeScreenshot(c, *screenshot, *scale); err != nil {
+			return err
+		}
+	}
+	if *mux != "" {
+		if err := muxVideo(*video, *wav, *mux); err != nil {
+			return err
+		}
+	}
+	return runErr
+}
+
+// runFrames runs the CPU for a number of frames at speed instructions per second. The frames go on once the
+// program exits, so that the recordings last as long as asked.
+func runFrames(c *chip8.CPU, frames, speed int) error {
+	var budget float64
+	for i := 0; i < frames; i++ {
+		// As in Start, the fraction of an instruction left is carried over to the next frame.
+		budget += float64(speed) / 60
+		instructions := int(budget)
+		budget -= float64(instructions)
+		if err := c.RunFrame(instructions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/sdlui"
+	"github.com/rs/zerolog/log"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const speedStep = 50 // instructions per second
+
+// saveSlots are the function keys bound to the save state slots, starting from slot 1.
+var saveSlots = []sdl.Scancode{sdl.SCANCODE_F1, sdl.SCANCODE_F2, sdl.SCANCODE_F3, sdl.SCANCODE_F4}
+
+// hotkeys runs the emulator commands bound to the keys which are not part of the keypad.
+type hotkeys struct {
+	cpu *chip8.CPU
+	rom string
+	// tone is the tone of the buzzer, rendered in the audio recordings.
+	tone chip8.ToneConfig
+	// audio and video are the recordings in progress, if any. They are ticked by the CPU, so they are only
+	// set while the CPU is locked.
+	audio *chip8.AudioRecorder
+	video *chip8.VideoRecorder
+	// keymap binds the keys of the window or the terminal to the keypad.
+	keymap chip8.Keymap
+	// window is the window showing the remap screen, nil in the terminal.
+	window *sdlui.Window
+	// remap is the state of the remap screen while it is shown.
+	remap *remapping
+}
+
+// handle runs the command bound to the key of ke, if any, and reports whether the event was consumed.
+func (h *hotkeys) handle(ke *sdl.KeyboardEvent) bool {
+	c := h.cpu
+	pressed := ke.State == sdl.PRESSED
+	for i, key := range saveSlots {
+		if ke.Keysym.Scancode != key {
+			continue
+		}
+		if pressed && ke.Repeat == 0 {
+			if ke.Keysym.Mod&sdl.KMOD_SHIFT != 0 {
+				h.loadState(i + 1)
+			} else {
+				h.saveState(i + 1)
+			}
+		}
+		return true
+	}
+
+	switch ke.Keysym.Scancode {
+	case sdl.SCANCODE_BACKSPACE:
+		c.SetRewinding(pressed)
+	case sdl.SCANCODE_TAB:
+		c.SetFastForward(pressed)
+	case sdl.SCANCODE_P:
+		if pressed && ke.Repeat == 0 {
+			h.togglePause()
+		}
+	case sdl.SCANCODE_N:
+		if pressed {
+			c.AdvanceFrame()
+		}
+	case sdl.SCANCODE_EQUALS:
+		if pressed {
+			h.changeSpeed(speedStep)
+		}
+	case sdl.SCANCODE_MINUS:
+		if pressed {
+			h.changeSpeed(-speedStep)
+		}
+	case sdl.SCANCODE_F5:
+		if pressed && ke.Repeat == 0 {
+			h.startRemap()
+		}
+	case sdl.SCANCODE_F9:
+		if pressed && ke.Repeat == 0 {
+			h.toggleAudioRecording()
+		}
+	case sdl.SCANCODE_F10:
+		if pressed && ke.Repeat == 0 {
+			h.toggleVideoRecording()
+		}
+	case sdl.SCANCODE_F12:
+		if pressed && ke.Repeat == 0 {
+			h.screenshot()
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (h *hotkeys) togglePause() {
+	if h.cpu.Paused() {
+		h.cpu.Resume()
+	} else {
+		h.cpu.Pause()
+	}
+}
+
+func (h *hotkeys) changeSpeed(delta int) {
+	h.cpu.SetSpeed(h.cpu.Speed() + delta)
+	log.Info().Msgf("speed: %d instructions per second", h.cpu.Speed())
+}
+
+func (h *hotkeys) toggleAudioRecording() {
+	if h.audio != nil {
+		h.stopAudioRecording()
+	} else if err := h.startAudioRecording(h.capturePath("wav")); err != nil {
+		log.Error().Err(err).Msg("unable to record the audio")
+	}
+}
+
+func (h *hotkeys) toggleVideoRecording() {
+	if h.video != nil {
+		h.stopVideoRecording()
+	} else if err := h.startVideoRecording(h.capturePath("gif")); err != nil {
+		log.Error().Err(err).Msg("unable to record the video")
+	}
+}
+
+func (h *hotkeys) screenshot() {
+	path := h.capturePath("png")
+	if err := writeScreenshot(h.cpu, path, windowScale); err != nil {
+		log.Error().Err(err).Msg("unable to take a screenshot")
+	} else {
+		log.Info().Msgf("screenshot saved to %s", path)
+	}
+}
+
+func (h *hotkeys) statePath(slot int) string {
+	return fmt.Sprintf("%s.state%d", h.rom, slot)
+}
+
+func (h *hotkeys) saveState(slot int) {
+	f, err := os.Create(h.statePath(slot))
+	if err != nil {
+		log.Error().Err(err).Msg("unable to save state")
+		return
+	}
+	defer f.Close()
+	if err := h.cpu.SaveState(f); err != nil {
+		log.Error().Err(err).Msg("unable to save state")
+		return
+	}
+	log.Info().Msgf("state saved to slot %d", slot)
+}
+
+func (h *hotkeys) loadState(slot int) {
+	f, err := os.Open(h.statePath(slot))
+	if err != nil {
+		log.Error().Err(err).Msg("unable to load state")
+		return
+	}
+	defer f.Close()
+	if err := h.cpu.LoadState(f); err != nil {
+		log.Error().Err(err).Msg("unable to load state")
+		return
+	}
+	log.Info().Msgf("state loaded from slot %d", slot)
+}
+
+// capturePath returns the path of a new capture of the ROM, e.g. a recording, with a timestamp.
+func (h *hotkeys) capturePath(ext string) string {
+	return fmt.Sprintf("%s-%s.%s", h.rom, time.Now().Format("20060102-150405"), ext)
+}
+
+// tick records the tick of the timer which just happened. It is the Tick hook of the CPU.
+func (h *hotkeys) tick() {
+	if h.audio != nil {
+		h.audio.Tick()
+	}
+	if h.video != nil {
+		h.video.Tick()
+	}
+}
+
+// startAudioRecording records the buzzer to a WAV file at path, until stopAudioRecording is called.
+func (h *hotkeys) startAudioRecording(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	c := h.cpu
+	audio, err := chip8.NewAudioRecorder(c, f, h.tone)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	c.Exclusive(func() {
+		h.audio = audio
+		c.Hooks.Tick = h.tick
+	})
+	log.Info().Msgf("recording the audio to %s", path)
+	return nil
+}
+
+func (h *hotkeys) stopAudioRecording() {
+	audio := h.audio
+	h.cpu.Exclusive(func() {
+		h.audio = nil
+	})
+	if err := audio.Close(); err != nil {
+		log.Error().Err(err).Msg("unable to record the audio")
+	} else {
+		log.Info().Msgf("recorded %d frames of audio", audio.Frames())
+	}
+}
+
+// startVideoRecording records the display to an animated GIF or a Y4M file at path, until
+// stopVideoRecording is called.
+func (h *hotkeys) startVideoRecording(path string) error {
+	c := h.cpu
+	video, err := newVideoRecorder(c, path, videoScale)
+	if err != nil {
+		return err
+	}
+	c.Exclusive(func() {
+		h.video = video
+		c.Hooks.Tick = h.tick
+	})
+	log.Info().Msgf("recording the video to %s", path)
+	return nil
+}
+
+func (h *hotkeys) stopVideoRecording() {
+	video := h.video
+	h.cpu.Exclusive(func() {
+		h.video = nil
+	})
+	if err := video.Close(); err != nil {
+		log.Error().Err(err).Msg("unable to record the video")
+	} else {
+		log.Info().Msgf("recorded %d frames of video", video.Frames())
+	}
+}
+
+// close completes the recordings in progress.
+func (h *hotkeys) close() {
+	if h.video != nil {
+		h.stopVideoRecording()
+	}
+	if h.audio != nil {
+		h.stopAudioRecording()
+	}
+}
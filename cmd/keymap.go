@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/sdlui"
+	"github.com/rs/zerolog/log"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// keymapPath returns the path of the keymap of the ROM, written by the remap screen.
+func keymapPath(rom string) string {
+	return rom + ".keymap"
+}
+
+// loadKeymap returns the keymap named by the -keymap flag, a preset or a JSON file. Without it, the keymap of
+// the ROM is used if it has one, and the default one otherwise.
+func loadKeymap(name, rom string) (chip8.Keymap, error) {
+	if name != "" {
+		if keymap, ok := chip8.KeymapPresets[name]; ok {
+			return keymap, nil
+		}
+		return chip8.LoadKeymap(name)
+	}
+	keymap, err := chip8.LoadKeymap(keymapPath(rom))
+	if errors.Is(err, os.ErrNotExist) {
+		return chip8.DefaultKeymap, nil
+	}
+	return keymap, err
+}
+
+// remapping is the state of the remap screen, which asks for the host key of every key of the keypad in turn.
+type remapping struct {
+	keymap chip8.Keymap
+	next   int
+	// paused is whether the CPU was paused before remapping, so that it is resumed after otherwise.
+	paused bool
+}
+
+// startRemap shows the remap screen in the window. The CPU is paused meanwhile.
+func (h *hotkeys) startRemap() {
+	if h.window == nil {
+		return
+	}
+	h.remap = &remapping{paused: h.cpu.Paused()}
+	h.cpu.Pause()
+	// The keys held are released, since their release goes to the remap screen.
+	h.cpu.Keyboard.SetState([16]bool{})
+	h.askKey("")
+}
+
+// askKey shows the key of the keypad the next host key is bound to, after msg.
+func (h *hotkeys) askKey(msg string) {
+	key := uint8(h.remap.next)
+	title := fmt.Sprintf("%sPress the key for %X (%d/16), Backspace keeps %v, Esc cancels", msg, key,
+		h.remap.next+1, h.keymap[key])
+	h.window.ShowKey(key, title)
+}
+
+// remapKey handles the key events while the remap screen is shown.
+func (h *hotkeys) remapKey(ke *sdl.KeyboardEvent) {
+	if ke.State != sdl.PRESSED || ke.Repeat != 0 {
+		return
+	}
+	r := h.remap
+	key := uint8(r.next)
+	switch ke.Keysym.Scancode {
+	case sdl.SCANCODE_ESCAPE:
+		log.Info().Msg("keymap unchanged")
+		h.stopRemap()
+		return
+	case sdl.SCANCODE_BACKSPACE:
+		for _, name := range h.keymap[key] {
+			r.keymap = r.keymap.With(key, name)
+		}
+	default:
+		name := sdlui.KeyName(ke.Keysym.Scancode)
+		if name == "" {
+			return
+		}
+		if bound, ok := r.keymap.Key(name); ok {
+			h.askKey(fmt.Sprintf("%s is bound to %X. ", name, bound))
+			return
+		}
+		r.keymap = r.keymap.With(key, name)
+	}
+
+	r.next++
+	if r.next < len(r.keymap) {
+		h.askKey("")
+		return
+	}
+	h.keymap = r.keymap
+	path := keymapPath(h.rom)
+	if err := h.keymap.Save(path); err != nil {
+		log.Error().Err(err).Msg("unable to save the keymap")
+	} else {
+		log.Info().Msgf("keymap saved to %s", path)
+	}
+	h.stopRemap()
+}
+
+// stopRemap shows the display again, and resumes the CPU if it was running.
+func (h *hotkeys) stopRemap() {
+	h.window.SetTitle(sdlui.Title)
+	c := h.cpu
+	c.Exclusive(func() {
+		c.Display.Draw()
+	})
+	if !h.remap.paused {
+		c.Resume()
+	}
+	h.remap = nil
+}
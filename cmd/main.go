@@ -2,20 +2,99 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/sdlui"
+	"github.com/imrenagi/chip8/terminal"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
+var policies = map[string]chip8.Policy{
+	"wrap": chip8.PolicyWrap,
+	"trap": chip8.PolicyTrap,
+	"log":  chip8.PolicyLog,
+}
+
+// commands are the tools run with "chip8 <command> [args]" instead of the emulator.
+var commands = map[string]func(args []string) error{
+	"asm":       runAsm,
+	"dap":       runDAP,
+	"disasm":    runDisasm,
+	"headless":  runHeadless,
+	"trace":     runTrace,
+	"tracediff": runTraceDiff,
+}
+
 func main() {
 	zerolog.SetGlobalLevel(zerolog.ErrorLevel)
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
 
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	quirksName := flag.String("quirks", "legacy", "quirks profile: legacy, vip, chip48, schip, modern, octo or xochip")
+	violations := flag.String("violations", "", "policy for stack and memory violations: wrap, trap or log (default traps stack errors and wraps memory)")
+	speed := flag.Int("speed", 500, "instructions executed per second")
+	rewind := flag.Duration("rewind", 10*time.Second, "length of the gameplay kept for rewinding, 0 disables it")
+	debug := flag.Bool("debug", false, "start paused with the debugger reading commands from the terminal")
+	gdbAddr := flag.String("gdb", "", "start paused and serve the GDB remote protocol on this address, e.g. localhost:1234")
+	tracePath := flag.String("trace", "", "write the trace of the executed instructions to this file")
+	traceFormat := flag.String("trace-format", "jsonl", "format of the trace: jsonl or binary")
+	audioFlags := addAudioFlags(flag.CommandLine)
+	recordAudio := flag.String("record-audio", "", "record the buzzer to this WAV file")
+	recordVideo := flag.String("record-video", "", "record the display to this animated GIF (.gif) or raw video (.y4m) file")
+	terminalName := flag.String("terminal", "", "draw in the terminal instead of a window: halfblock or braille")
+	keymapName := flag.String("keymap", "", "keymap: default, arrows or a JSON file (default: the ROM with the .keymap extension, if any)")
+	keyHold := flag.Duration("key-hold", 300*time.Millisecond, "how long a key typed in the terminal stays pressed")
+	symbolsPath := flag.String("symbols", "", "symbol map for the debugger (default: the ROM with the .sym extension, if any)")
+	flag.Parse()
+
+	rom := "examples/c8games/PONG"
+	if flag.NArg() > 0 {
+		rom = flag.Arg(0)
+	}
+	if *debug && *gdbAddr != "" {
+		log.Fatal().Msg("-debug and -gdb cannot be used together")
+	}
+	if *debug && *terminalName != "" {
+		log.Fatal().Msg("-debug and -terminal cannot be used together, use -gdb")
+	}
+	terminalMode, ok := terminal.Modes[*terminalName]
+	if *terminalName != "" && !ok {
+		log.Fatal().Msgf("unknown terminal mode %q", *terminalName)
+	}
+	quirks, ok := chip8.QuirksPresets[*quirksName]
+	if !ok {
+		log.Fatal().Msgf("unknown quirks profile %q", *quirksName)
+	}
+	protection := chip8.DefaultProtection
+	if *violations != "" {
+		policy, ok := policies[*violations]
+		if !ok {
+			log.Fatal().Msgf("unknown violation policy %q", *violations)
+		}
+		protection = chip8.Protection{
+			StackOverflow:     policy,
+			StackUnderflow:    policy,
+			MemoryOutOfBounds: policy,
+		}
+	}
+
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 
@@ -29,32 +108,128 @@ func main() {
 		cancel()
 	}()
 
-	if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
-		panic(err)
+	keymap, err := loadKeymap(*keymapName, rom)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to load the keymap")
 	}
 
-	display := chip8.DefaultDisplay()
+	var display chip8.Display
+	var drawer *terminal.Drawer
+	var window *sdlui.Window
+	if *terminalName != "" {
+		// The logs are written to the standard error, which can be redirected so as not to garble the screen.
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+		drawer = terminal.NewDrawer(os.Stdout, terminalMode)
+		display = chip8.NewDisplay(drawer)
+	} else {
+		if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
+			panic(err)
+		}
+		window = sdlui.NewWindow()
+		display = chip8.NewDisplay(window)
+	}
 	keyboard := chip8.NewKeyboard()
-	audio := chip8.NewAudioController()
+	tone, err := audioFlags.config()
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid tone")
+	}
+	audio, err := audioFlags.sink()
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to open the audio")
+	}
 
-	c := chip8.NewCPU(&display, keyboard, audio)
-	c.LoadProgram("examples/c8games/PONG")
+	c := chip8.NewCPU(&display, keyboard, audio, quirks)
+	c.Protection = protection
+	c.SetSpeed(*speed)
+	c.EnableRewind(*rewind)
+	if err := c.LoadProgram(rom); err != nil {
+		log.Fatal().Err(err).Msg("unable to load the ROM")
+	}
+	if err := c.SetFlagsFile(rom + ".flags"); err != nil {
+		log.Error().Err(err).Msg("unable to load flags")
+	}
 	// c.LoadProgram("examples/test_opcode.ch8")
-	go c.Start(ctx)
+	if *debug {
+		startDebugger(c, rom, *symbolsPath, cancel)
+	}
+	if *gdbAddr != "" {
+		startGDBServer(ctx, c, *gdbAddr, cancel)
+	}
+	// The tracer is set up after the debuggers, since it calls the hooks set before it.
+	stopTracer := func() error { return nil }
+	if *tracePath != "" {
+		stop, err := startTracer(c, *tracePath, *traceFormat)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to trace")
+		}
+		stopTracer = stop
+	}
+	// The CPU closes the audio sink when it stops, which completes the file of -audio wav:FILE.
+	stopped := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(stopped)
+	}()
 
+	keys := &hotkeys{cpu: c, rom: rom, tone: tone, keymap: keymap, window: window}
+	if *recordAudio != "" {
+		if err := keys.startAudioRecording(*recordAudio); err != nil {
+			log.Fatal().Err(err).Msg("unable to record the audio")
+		}
+	}
+	if *recordVideo != "" {
+		if err := keys.startVideoRecording(*recordVideo); err != nil {
+			log.Fatal().Err(err).Msg("unable to record the video")
+		}
+	}
+	if drawer != nil {
+		restore, err := terminal.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to read the keys from the terminal")
+		}
+		terminalLoop(ctx, c, terminal.NewKeypad(keyboard, keymap, *keyHold), keys)
+		drawer.Stop()
+		restore()
+	} else {
+		eventLoop(ctx, c, keyboard, keys)
+	}
+	keys.close()
+	cancel()
+	<-stopped
+	if err := stopTracer(); err != nil {
+		log.Error().Err(err).Msg("unable to write the trace")
+	}
+}
+
+// eventLoop forwards the SDL events to the emulator until the window is closed or ctx is cancelled. It must
+// run on the main thread.
+func eventLoop(ctx context.Context, c *chip8.CPU, keyboard *chip8.Keyboard, keys *hotkeys) {
 exit:
 	for {
+		select {
+		case <-ctx.Done():
+			break exit
+		case err := <-c.Errors():
+			msg := fmt.Sprintf("The emulator stopped:\n%s", err)
+			sdl.ShowSimpleMessageBox(sdl.MESSAGEBOX_ERROR, "chip-8 crashed", msg, nil)
+		default:
+		}
 		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 			switch event.(type) {
 			case *sdl.QuitEvent:
 				break exit
 			case *sdl.KeyboardEvent:
 				ke := event.(*sdl.KeyboardEvent)
-				var pressed bool
-				if ke.State == sdl.PRESSED {
-					pressed = true
+				if keys.remap != nil {
+					keys.remapKey(ke)
+					continue
+				}
+				if keys.handle(ke) {
+					continue
+				}
+				if key, ok := keys.keymap.Key(sdlui.KeyName(ke.Keysym.Scancode)); ok {
+					keyboard.Accept(chip8.NewKeyEvent(ke.State == sdl.PRESSED, key))
 				}
-				keyboard.Accept(chip8.NewKeyEvent(pressed, ke.Keysym.Scancode))
 			}
 		}
 	}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+
+	"github.com/imrenagi/chip8"
+)
+
+// windowScale is the scale of the screenshots taken with the hotkey, that of the window.
+const windowScale = 10
+
+// writeScreenshot writes the display of the CPU to a PNG file.
+func writeScreenshot(c *chip8.CPU, path string, scale int) error {
+	var img image.Image
+	c.Exclusive(func() {
+		img = c.Display.Snapshot(scale, chip8.DefaultPalette)
+	})
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
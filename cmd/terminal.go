@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/terminal"
+	"github.com/rs/zerolog/log"
+)
+
+// terminalHotkeys returns the commands of the hotkeys bound in the terminal, by the characters or escape
+// sequences their keys send. Tab and Backspace are left out, since the terminal does not tell when they are
+// released.
+func (h *hotkeys) terminalHotkeys() map[string]func() {
+	keys := map[string]func(){
+		"p":        h.togglePause,
+		"n":        h.cpu.AdvanceFrame,
+		"=":        func() { h.changeSpeed(speedStep) },
+		"-":        func() { h.changeSpeed(-speedStep) },
+		"\x1b[20~": h.toggleAudioRecording, // F9
+		"\x1b[21~": h.toggleVideoRecording, // F10
+		"\x1b[24~": h.screenshot,           // F12
+	}
+	// F1 to F4 save the states, and Shift+F1 to Shift+F4 load them.
+	for i, c := range "PQRS" {
+		slot := i + 1
+		keys["\x1bO"+string(c)] = func() { h.saveState(slot) }
+		keys["\x1b[1;2"+string(c)] = func() { h.loadState(slot) }
+	}
+	return keys
+}
+
+// terminalArrows are the names of the arrow keys by their escape sequences, in the normal and application
+// cursor modes.
+var terminalArrows = map[string]string{
+	"\x1b[A": "Up", "\x1b[B": "Down", "\x1b[C": "Right", "\x1b[D": "Left",
+	"\x1bOA": "Up", "\x1bOB": "Down", "\x1bOC": "Right", "\x1bOD": "Left",
+}
+
+// terminalLoop reads the keys typed in the terminal of the standard input, which must be in raw mode, and
+// forwards them to the emulator until Ctrl+C or Esc is typed or ctx is cancelled.
+func terminalLoop(ctx context.Context, c *chip8.CPU, keypad *terminal.Keypad, keys *hotkeys) {
+	input := make(chan []byte)
+	go func() {
+		for {
+			buf := make([]byte, 64)
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				log.Error().Err(err).Msg("unable to read the terminal")
+				close(input)
+				return
+			}
+			input <- buf[:n]
+		}
+	}()
+
+	hotkeys := keys.terminalHotkeys()
+	for {
+		var typed []byte
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-c.Errors():
+			log.Error().Err(err).Msg("the emulator stopped")
+			continue
+		case typed, ok = <-input:
+			if !ok {
+				return
+			}
+		}
+
+		// Esc is told apart from the escape sequences by coming alone.
+		if string(typed) == "\x1b" {
+			return
+		}
+		for len(typed) > 0 {
+			if typed[0] == 0x1b {
+				seq, ok := escapeSequence(typed, hotkeys)
+				if !ok {
+					// The rest of an unknown escape sequence cannot be told apart from the keys typed
+					// after it, so it is all dropped.
+					break
+				}
+				typed = typed[len(seq):]
+				if f, ok := hotkeys[seq]; ok {
+					f()
+				} else {
+					keypad.Press(terminalArrows[seq])
+				}
+				continue
+			}
+			if typed[0] == 0x03 { // Ctrl+C
+				return
+			}
+			r, size := utf8.DecodeRune(typed)
+			typed = typed[size:]
+			if f, ok := hotkeys[string(r)]; ok {
+				f()
+			} else {
+				keypad.Type(r)
+			}
+		}
+	}
+}
+
+// escapeSequence returns the hotkey or arrow whose escape sequence starts typed, if any.
+func escapeSequence(typed []byte, hotkeys map[string]func()) (string, bool) {
+	for seq := range hotkeys {
+		if strings.HasPrefix(string(typed), seq) && seq[0] == 0x1b {
+			return seq, true
+		}
+	}
+	for seq := range terminalArrows {
+		if strings.HasPrefix(string(typed), seq) {
+			return seq, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/trace"
+)
+
+// runTrace implements "chip8 trace [flags] ROM", which runs a ROM headless and writes the trace of the
+// instructions it executes. Without a window or a clock, the runs are repeatable.
+func runTrace(args []string) error {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	quirksName := fs.String("quirks", "legacy", "quirks profile: legacy, vip, chip48, schip, modern, octo or xochip")
+	steps := fs.Int("steps", 100000, "number of instructions to execute, unless the program exits before")
+	perFrame := fs.Int("ipf", 8, "instructions executed between two ticks of the timers")
+	formatName := fs.String("format", "jsonl", "format of the trace: jsonl or binary")
+	seed := fs.Int64("seed", 1, "seed of the random numbers of RND")
+	outPath := fs.String("o", "", "path of the trace (default: the standard output)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s trace [flags] ROM\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *perFrame < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	quirks, ok := chip8.QuirksPresets[*quirksName]
+	if !ok {
+		return fmt.Errorf("unknown quirks profile %q", *quirksName)
+	}
+	format, ok := trace.Formats[*formatName]
+	if !ok {
+		return fmt.Errorf("unknown trace format %q", *formatName)
+	}
+
+	config := runConfig{quirks: quirks, perFrame: *perFrame, seed: *seed}
+	program, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	run, err := config.start(program)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := trace.NewWriter(out, format)
+	for n := 0; n < *steps; n++ {
+		r, err := read(run)
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			break
+		}
+		if err := w.Write(r); err != nil {
+			return err
+		}
+		if r.Error != "" {
+			// The error the program stopped at is in the trace too.
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			return errors.New(r.Error)
+		}
+	}
+	return w.Flush()
+}
+
+// startTracer writes the trace of the instructions executed by the emulator to path, until the returned
+// function is called.
+func startTracer(c *chip8.CPU, path, formatName string) (func() error, error) {
+	format, ok := trace.Formats[formatName]
+	if !ok {
+		return nil, fmt.Errorf("unknown trace format %q", formatName)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	tracer := trace.New(c, trace.NewWriter(f, format))
+	return func() error {
+		err := tracer.Close()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/trace"
+)
+
+// runConfig is the configuration of a run of tracediff, e.g. "quirks=schip,ipf=10,shift-vy=true".
+type runConfig struct {
+	quirks   chip8.Quirks
+	perFrame int
+	seed     int64
+}
+
+var incrementModes = map[string]chip8.IncrementMode{
+	"none": chip8.IncrementNone,
+	"x":    chip8.IncrementX,
+	"x+1":  chip8.IncrementXPlusOne,
+}
+
+// parseRunConfig parses a comma separated list of settings. The quirks profile is applied first, so that
+// the single quirks override it.
+func parseRunConfig(s string) (runConfig, error) {
+	config := runConfig{quirks: chip8.QuirksLegacy, perFrame: 8, seed: 1}
+	settings := map[string]string{}
+	var keys []string
+	for _, field := range strings.Split(s, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return config, fmt.Errorf("expected key=value, got %q", field)
+		}
+		key = strings.TrimSpace(key)
+		settings[key] = strings.TrimSpace(value)
+		keys = append(keys, key)
+	}
+	if name, ok := settings["quirks"]; ok {
+		quirks, ok := chip8.QuirksPresets[name]
+		if !ok {
+			return config, fmt.Errorf("unknown quirks profile %q", name)
+		}
+		config.quirks = quirks
+	}
+
+	bools := map[string]*bool{
+		"shift-vy": &config.quirks.ShiftUsesVY,
+		"jump-vx":  &config.quirks.JumpUsesVX,
+		"logic-vf": &config.quirks.LogicResetsVF,
+		"wrap":     &config.quirks.WrapSprites,
+		"extended": &config.quirks.ExtendedMemory,
+	}
+	for _, key := range keys {
+		value := settings[key]
+		var err error
+		switch key {
+		case "quirks":
+		case "ipf":
+			config.perFrame, err = strconv.Atoi(value)
+			if err == nil && config.perFrame < 1 {
+				err = errors.New("must be at least 1")
+			}
+		case "seed":
+			config.seed, err = strconv.ParseInt(value, 0, 64)
+		case "increment":
+			mode, ok := incrementModes[value]
+			if !ok {
+				err = errors.New("expected none, x or x+1")
+			}
+			config.quirks.LoadStoreIncrement = mode
+		default:
+			b, ok := bools[key]
+			if !ok {
+				return config, fmt.Errorf("unknown setting %q", key)
+			}
+			*b, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			return config, fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+	}
+	return config, nil
+}
+
+// start returns a run of the program under the configuration.
+func (config runConfig) start(program []byte) (*trace.Run, error) {
+	c := chip8.NewHeadlessCPU(config.quirks)
+	c.Rand = rand.New(rand.NewSource(config.seed))
+	if err := c.LoadProgramBytes(program); err != nil {
+		return nil, err
+	}
+	return trace.NewRun(c, config.perFrame), nil
+}
+
+// runTraceDiff implements "chip8 tracediff [flags] ROM", which runs a ROM under two configurations, or
+// against a reference trace, and reports the first instruction where the runs diverge.
+func runTraceDiff(args []string) error {
+	fs := flag.NewFlagSet("tracediff", flag.ExitOnError)
+	configA := fs.String("a", "", "configuration of the first run, e.g. quirks=vip,ipf=8,seed=1")
+	configB := fs.String("b", "", "configuration of the second run, with the same settings as -a")
+	ref := fs.String("ref", "", "trace to compare the first run with, instead of running the second one")
+	steps := fs.Int("steps", 100000, "number of instructions to compare")
+	context := fs.Int("context", 5, "number of matching instructions shown before the divergence")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s tracediff [flags] ROM\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "The settings of the configurations are quirks=PROFILE, ipf=N (instructions between timer ticks),")
+		fmt.Fprintln(fs.Output(), "seed=N, shift-vy, jump-vx, logic-vf, wrap, extended (true or false) and increment=none|x|x+1.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config, err := parseRunConfig(*configA)
+	if err != nil {
+		return fmt.Errorf("-a: %w", err)
+	}
+	program, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	a, err := config.start(program)
+	if err != nil {
+		return err
+	}
+	var b trace.Source
+	if *ref != "" {
+		f, err := os.Open(*ref)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if b, err = trace.NewReader(f); err != nil {
+			return err
+		}
+	} else {
+		config, err := parseRunConfig(*configB)
+		if err != nil {
+			return fmt.Errorf("-b: %w", err)
+		}
+		if b, err = config.start(program); err != nil {
+			return err
+		}
+	}
+
+	diverged, err := diffTraces(os.Stdout, a, b, *steps, *context)
+	if err != nil {
+		return err
+	}
+	if diverged {
+		return errors.New("the runs diverge")
+	}
+	return nil
+}
+
+// diffTraces compares the sources record by record and reports the first divergence to w.
+func diffTraces(w io.Writer, a, b trace.Source, steps, context int) (bool, error) {
+	var recent []*trace.Record
+	for n := 0; n < steps; n++ {
+		ra, errA := read(a)
+		rb, errB := read(b)
+		if errA != nil {
+			return false, fmt.Errorf("a: %w", errA)
+		}
+		if errB != nil {
+			return false, fmt.Errorf("b: %w", errB)
+		}
+
+		switch {
+		case ra == nil && rb == nil:
+			fmt.Fprintf(w, "the runs match, both ending after %d instructions\n", n)
+			return false, nil
+		case ra == nil || rb == nil:
+			writeContext(w, recent)
+			ended, other, next := "a", "b", rb
+			if rb == nil {
+				ended, other, next = "b", "a", ra
+			}
+			fmt.Fprintf(w, "%s ended after %d instructions, %s continues with\n  %s: %s\n", ended, n, other, other, next)
+			return true, nil
+		}
+
+		if diffs := trace.Diff(ra, rb); len(diffs) > 0 {
+			writeContext(w, recent)
+			fmt.Fprintf(w, "diverged at instruction %d:\n  a: %s\n  b: %s\n", n, ra, rb)
+			for _, d := range diffs {
+				fmt.Fprintf(w, "  %s\n", d)
+			}
+			return true, nil
+		}
+		if context > 0 {
+			if len(recent) == context {
+				recent = recent[1:]
+			}
+			recent = append(recent, ra)
+		}
+	}
+	fmt.Fprintf(w, "the runs match for %d instructions\n", steps)
+	return false, nil
+}
+
+// read returns the next record of a source, or nil at its end.
+func read(s trace.Source) (*trace.Record, error) {
+	r, err := s.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	return r, err
+}
+
+func writeContext(w io.Writer, recent []*trace.Record) {
+	if len(recent) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "last matching instructions:")
+	for _, r := range recent {
+		fmt.Fprintf(w, "     %s\n", r)
+	}
+}
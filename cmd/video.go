@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/imrenagi/chip8"
+)
+
+// videoScale is the default scale of the video recordings: the 128x64 screen is recorded at 512x256.
+const videoScale = 4
+
+// recorder records the CPU at every tick of the timer, see chip8.AudioRecorder and chip8.VideoRecorder.
+type recorder interface {
+	Tick()
+	Close() error
+}
+
+// newVideoRecorder returns a recorder of the display of the CPU to path, an animated GIF or a raw Y4M video
+// by its extension. The caller ticks it from the Tick hook of the CPU.
+func newVideoRecorder(c *chip8.CPU, path string, scale int) (*chip8.VideoRecorder, error) {
+	var newEncoder func(f *os.File) chip8.VideoEncoder
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".gif":
+		newEncoder = func(f *os.File) chip8.VideoEncoder { return chip8.NewGIFEncoder(f) }
+	case ".y4m":
+		newEncoder = func(f *os.File) chip8.VideoEncoder { return chip8.NewY4MEncoder(f) }
+	default:
+		return nil, fmt.Errorf("unknown video format %q, use .gif or .y4m", ext)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return chip8.NewVideoRecorder(c.Display, newEncoder(f), scale, chip8.DefaultPalette), nil
+}
+
+// muxVideo combines a video and a WAV audio track of the same run into out with ffmpeg, which must be
+// installed. The format of out is chosen by ffmpeg from its extension, e.g. .mp4 or .mkv.
+func muxVideo(video, audio, out string) error {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return fmt.Errorf("ffmpeg is needed to mux the audio: %w", err)
+	}
+	cmd := exec.Command(ffmpeg, "-y", "-loglevel", "error", "-i", video, "-i", audio,
+		"-pix_fmt", "yuv420p", "-shortest", out)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package chip8
+
+import "sync"
+
+// control holds the settings changed from other goroutines while Start runs.
+type control struct {
+	sync.Mutex
+	speed       int
+	paused      bool
+	fastForward bool
+	framesToRun int
+	rewinding   bool
+	// resumes counts the calls to Resume, so that a break does not pause the execution resumed after it.
+	resumes int
+}
+
+// SetSpeed sets the number of instructions Start executes per second.
+func (c *CPU) SetSpeed(instructionsPerSecond int) {
+	if instructionsPerSecond < 1 {
+		instructionsPerSecond = 1
+	}
+	c.control.Lock()
+	defer c.control.Unlock()
+	c.control.speed = instructionsPerSecond
+}
+
+// Speed returns the number of instructions Start executes per second.
+func (c *CPU) Speed() int {
+	c.control.Lock()
+	defer c.control.Unlock()
+	return c.control.speed
+}
+
+// Pause stops Start from executing instructions and ticking the timers, until Resume is called.
+// The display and the audio are left untouched.
+func (c *CPU) Pause() {
+	c.control.Lock()
+	defer c.control.Unlock()
+	c.control.paused = true
+}
+
+// Resume continues the execution stopped by Pause.
+func (c *CPU) Resume() {
+	c.control.Lock()
+	defer c.control.Unlock()
+	c.control.paused = false
+	c.control.framesToRun = 0
+	c.control.resumes++
+}
+
+// resumeCount returns the number of calls to Resume so far.
+func (c *CPU) resumeCount() int {
+	c.control.Lock()
+	defer c.control.Unlock()
+	return c.control.resumes
+}
+
+// pauseAfterBreak pauses the execution stopped by ErrBreak, unless Resume was called since resumes was
+// read: the hook returning ErrBreak may already have reported the break, and been told to continue.
+func (c *CPU) pauseAfterBreak(resumes int) {
+	c.control.Lock()
+	defer c.control.Unlock()
+	if c.control.resumes == resumes {
+		c.control.paused = true
+	}
+}
+
+// Paused reports whether the execution is paused.
+func (c *CPU) Paused() bool {
+	c.control.Lock()
+	defer c.control.Unlock()
+	return c.control.paused
+}
+
+// AdvanceFrame makes Start run a single frame while it is paused.
+func (c *CPU) AdvanceFrame() {
+	c.control.Lock()
+	defer c.control.Unlock()
+	if c.control.paused {
+		c.control.framesToRun++
+	}
+}
+
+// SetFastForward makes Start run frames as fast as possible instead of at 60 frames per second.
+func (c *CPU) SetFastForward(enabled bool) {
+	c.control.Lock()
+	defer c.control.Unlock()
+	c.control.fastForward = enabled
+}
+
+// FastForward reports whether fast forward is enabled.
+func (c *CPU) FastForward() bool {
+	c.control.Lock()
+	defer c.control.Unlock()
+	return c.control.fastForward
+}
+
+// nextFrame reports whether Start should run the next frame.
+func (c *CPU) nextFrame() bool {
+	c.control.Lock()
+	defer c.control.Unlock()
+	if !c.control.paused {
+		return true
+	}
+	if c.control.framesToRun > 0 {
+		c.control.framesToRun--
+		return true
+	}
+	return false
+}
@@ -2,14 +2,16 @@ package chip8
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math"
 	"math/rand"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/imrenagi/chip8/opcode"
 	"github.com/rs/zerolog/log"
-	"github.com/veandco/go-sdl2/sdl"
 )
 
 var (
@@ -31,30 +33,66 @@ var (
 		0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
 		0xF0, 0x80, 0xF0, 0x80, 0x80, // F
 	}
+
+	// bigFonts are the 8x10 SUPER-CHIP digits used by Fx30.
+	bigFonts = []byte{
+		0xFF, 0xFF, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, // 0
+		0x18, 0x78, 0x78, 0x18, 0x18, 0x18, 0x18, 0x18, 0xFF, 0xFF, // 1
+		0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // 2
+		0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 3
+		0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0x03, 0x03, // 4
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 5
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 6
+		0xFF, 0xFF, 0x03, 0x03, 0x06, 0x0C, 0x18, 0x18, 0x18, 0x18, // 7
+		0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 8
+		0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 9
+		0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, // A
+		0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, // B
+		0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C, // C
+		0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+	}
 )
 
 const (
 	clockFrequency = 500 // Hz
 	timerFrequency = 60  // Hz
+
+	fontStartAddr    = 0x050
+	bigFontStartAddr = 0x0A0
+
+	memorySize         = 0x1000
+	extendedMemorySize = 0x10000
 )
 
-func NewCPU(display *Display, keyboard *Keyboard, audio *AudioController) *CPU {
-	clockDuration := math.Round(float64(1) / float64(clockFrequency) * 1000)
-	timerDuration := math.Round(float64(1) / float64(timerFrequency) * 1000)
+// Glyph returns the rows of the 8x10 SUPER-CHIP sprite of the hex digit, e.g. for a frontend to show a key of
+// the keypad.
+func Glyph(digit uint8) []byte {
+	i := int(digit&0xF) * 10
+	return append([]byte(nil), bigFonts[i:i+10]...)
+}
 
-	cpu := &CPU{
-		PC:              0x200,
-		Display:         display,
-		Keyboard:        keyboard,
-		AudioController: audio,
-		clock:           time.NewTicker(time.Duration(clockDuration) * time.Millisecond),
-		timer:           time.NewTicker(time.Duration(timerDuration) * time.Millisecond),
+func NewCPU(display *Display, keyboard *Keyboard, audio AudioSink, quirks Quirks) *CPU {
+	size := memorySize
+	if quirks.ExtendedMemory {
+		size = extendedMemorySize
 	}
-	fontStartAddr := 0x050
-	for _, b := range fonts {
-		cpu.Memory[fontStartAddr] = b
-		fontStartAddr++
+
+	cpu := &CPU{
+		Memory:     make([]uint8, size),
+		PC:         0x200,
+		Display:    display,
+		Keyboard:   keyboard,
+		Audio:      audio,
+		Quirks:     quirks,
+		Protection: DefaultProtection,
+		errCh:      make(chan error, 1),
+		control:    control{speed: clockFrequency},
+		pitch:      defaultPitch,
 	}
+	copy(cpu.Memory[fontStartAddr:], fonts)
+	copy(cpu.Memory[bigFontStartAddr:], bigFonts)
 
 	return cpu
 }
@@ -65,7 +103,8 @@ type CPU struct {
 	// The first 512 bytes, from 0x000 to 0x1FF, are where the original interpreter was located, and should not be used
 	// by programs. Most Chip-8 programs start at location 0x200 (512), but some begin at 0x600 (1536).
 	// All instructions are 2 bytes long and are stored most-significant-byte first
-	Memory [4096]uint8
+	// XO-CHIP extends the memory to 64KB (65,536 bytes), see Quirks.ExtendedMemory.
+	Memory []uint8
 
 	// V is 16 general purpose 8-bit registers, usually referred to as Vx, where x is a hexadecimal digit (0 through F)
 	V [16]uint8
@@ -85,6 +124,7 @@ type CPU struct {
 	PC uint16
 
 	// The stack pointer (SP) can be 8-bit, it is used to point to the topmost level of the stack.
+	// It holds the number of addresses on the stack, so the topmost one is Stack[SP-1].
 	SP uint8
 
 	// The stack is an array of 16 16-bit values, used to store the address that the interpreter should return to when
@@ -92,12 +132,57 @@ type CPU struct {
 	// Chip-8 allows for up to 16 levels of nested subroutines.
 	Stack [16]uint16
 
-	Display         *Display
-	Keyboard        *Keyboard
-	AudioController *AudioController
+	Display  *Display
+	Keyboard *Keyboard
+	Audio    AudioSink
+
+	// Quirks selects how the ambiguous instructions behave.
+	Quirks Quirks
+
+	// Protection selects what happens when a program overflows the stack or accesses memory out of bounds.
+	Protection Protection
+
+	// Hooks are called while instructions execute, e.g. by a debugger.
+	Hooks Hooks
+
+	// Rand is the source of the random numbers of RND. When nil, the global source of math/rand is used.
+	// Seeding it makes the runs repeatable, e.g. to compare their traces.
+	Rand *rand.Rand
+
+	// Hires is true while the SUPER-CHIP 128x64 high resolution mode is enabled.
+	Hires bool
 
-	clock *time.Ticker
-	timer *time.Ticker
+	// RPL are the SUPER-CHIP user flags, named after the HP-48 RPL registers they were stored in.
+	// They survive between runs when a flags file is set with SetFlagsFile.
+	RPL [16]uint8
+
+	flagsPath string
+	// halted is atomic, since Halted is polled while Start runs.
+	halted   atomic.Bool
+	audioErr error
+	// buzzing is true while the buzzer sounds.
+	buzzing bool
+	errCh   chan error
+
+	// pattern and pitch are the XO-CHIP audio pattern loaded by F002, if hasPattern, and the pitch set by
+	// Fx3A. They are kept so that they can be loaded again into the audio sink, see replayAudio.
+	pattern    [16]uint8
+	hasPattern bool
+	pitch      uint8
+
+	// opPC is the address of the instruction being executed.
+	opPC uint16
+
+	// waitingKey is true while Fx0A waits for a key press.
+	waitingKey bool
+
+	control control
+
+	// exec is held while instructions execute, so that the state of the machine can be accessed
+	// from another goroutine between them.
+	exec sync.Mutex
+
+	rewinder *rewinder
 }
 
 func (c *CPU) LoadProgram(path string) error {
@@ -107,162 +192,353 @@ func (c *CPU) LoadProgram(path string) error {
 	}
 	defer f.Close()
 
-	buf := make([]byte, 4096)
+	buf := make([]byte, len(c.Memory)-int(c.PC))
 	n, err := f.Read(buf)
 	if err != nil {
 		return err
 	}
 
-	for i := 0; i < n; i++ {
-		c.Memory[c.PC+uint16(i)] = buf[i]
+	return c.LoadProgramBytes(buf[:n])
+}
+
+func (c *CPU) LoadProgramBytes(program []byte) error {
+	if int(c.PC)+len(program) > len(c.Memory) {
+		return fmt.Errorf("program of %d bytes does not fit in memory", len(program))
 	}
+	copy(c.Memory[c.PC:], program)
 	return nil
 }
 
-func (c *CPU) LoadProgramBytes(program []byte) error {
-	for i, b := range program {
-		c.Memory[c.PC+uint16(i)] = b
+// SetFlagsFile loads the RPL flags from path, if it exists, and makes Fx75 persist them to it.
+func (c *CPU) SetFlagsFile(path string) error {
+	c.flagsPath = path
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
+	copy(c.RPL[:], b)
 	return nil
 }
 
+// Start runs the CPU in real time until ctx is cancelled, executing one frame every tick of the 60Hz timer.
+// The execution can be controlled while it runs with SetSpeed, Pause, Resume, AdvanceFrame and SetFastForward.
+// When an instruction fails, the CPU stops executing instructions and the error is sent to the channel
+// returned by Errors.
 func (c *CPU) Start(ctx context.Context) {
+	ticker := time.NewTicker(time.Second / timerFrequency)
+	var budget float64
 	for {
-		select {
-		case <-c.timer.C:
-			if c.DT > 0 {
-				c.DT--
+		if c.FastForward() && !c.Paused() {
+			select {
+			case <-ctx.Done():
+				c.stop(ticker)
+				return
+			default:
 			}
-			if c.ST > 0 {
-				c.AudioController.Start()
-				c.ST--
-			} else {
-				c.AudioController.Stop()
+		} else {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				c.stop(ticker)
+				return
+			}
+		}
+
+		if c.Rewinding() {
+			c.rewindFrame()
+			c.silence()
+			continue
+		}
+
+		if !c.nextFrame() {
+			c.silence()
+			continue
+		}
+
+		// The speed rarely is a multiple of 60, so the fraction of an instruction left
+		// is carried over to the next frame.
+		budget += float64(c.Speed()) / timerFrequency
+		instructions := int(budget)
+		budget -= float64(instructions)
+
+		resumes := c.resumeCount()
+		err := c.RunFrame(instructions)
+		c.recordFrame()
+		if errors.Is(err, ErrBreak) {
+			c.pauseAfterBreak(resumes)
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("cpu is halted")
+			c.halted.Store(true)
+			select {
+			case c.errCh <- err:
+			default:
 			}
-		case <-c.clock.C:
-			instruction := c.Fetch()
-			c.DecodeAndExecute(instruction)
-		case <-ctx.Done():
-			c.clock.Stop()
-			c.timer.Stop()
-			c.Display.Stop()
-			c.AudioController.Destroy()
-			sdl.Quit()
-			log.Warn().Msg("cpu is stopped")
-			return
 		}
 	}
 }
 
-func (c *CPU) Fetch() uint16 {
-	msb := c.Memory[c.PC]
-	lsb := c.Memory[c.PC+1]
-	c.PC += 2
-	return uint16(msb)<<8 | uint16(lsb)
-}
-
-func (c *CPU) DecodeAndExecute(instruction uint16) {
-	msb := (instruction & 0xF000) >> 12
-	nnn := ((instruction << 4) & 0xFFFF) >> 4
-	kk := instruction & 0x00FF
-	n := instruction & 0x000F
-	x := (instruction & 0x0F00) >> 8
-	y := (instruction & 0x00F0) >> 4
-
-	switch msb {
-	case 0x0:
-		switch ((instruction & 0x0FFF) << 4) >> 4 {
-		case 0x0E0:
-			c.clearScreen()
-		case 0x0EE:
-			c.ret()
+// audio logs the errors of the audio sink. The emulation goes on without sound, and the same error is only
+// logged once.
+func (c *CPU) audio(err error) {
+	if err != nil && (c.audioErr == nil || err.Error() != c.audioErr.Error()) {
+		log.Error().Err(err).Msg("audio failed")
+	}
+	c.audioErr = err
+}
+
+// SetAudio replaces the audio sink, loading into it the XO-CHIP audio pattern and pitch set by the program.
+// It can be called while Start runs; the sink is then replaced between two frames.
+func (c *CPU) SetAudio(sink AudioSink) {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	c.Audio = sink
+	c.replayAudio()
+}
+
+// replayAudio loads the XO-CHIP audio pattern and pitch into the audio sink, after it was replaced or
+// the state of the machine restored.
+func (c *CPU) replayAudio() {
+	if c.hasPattern {
+		c.Audio.SetPattern(c.pattern)
+	} else {
+		c.Audio.ClearPattern()
+	}
+	c.Audio.SetPitch(c.pitch)
+}
+
+// silence stops the buzzer while Start runs no frame. The sink is only told once, so that the frames it
+// counts are those of the timer.
+func (c *CPU) silence() {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	if c.buzzing {
+		c.audio(c.Audio.Stop())
+		c.buzzing = false
+	}
+}
+
+func (c *CPU) stop(ticker *time.Ticker) {
+	ticker.Stop()
+	c.Display.Stop()
+	if err := c.Audio.Close(); err != nil {
+		log.Error().Err(err).Msg("unable to close the audio")
+	}
+	log.Warn().Msg("cpu is stopped")
+}
+
+// RunFrame executes instructionsPerFrame instructions, then ticks the timers once.
+// It stops at the first instruction that fails, without ticking the timers.
+func (c *CPU) RunFrame(instructionsPerFrame int) error {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	for i := 0; i < instructionsPerFrame && !c.halted.Load(); i++ {
+		if err := c.step(); err != nil {
+			return err
 		}
-	case 0x1:
-		c.jump(nnn)
-	case 0x2:
-		c.call(nnn)
-	case 0x3:
-		c.skipIfEqual(uint8(x), uint8(kk))
-	case 0x4:
-		c.skipIfNotEqual(uint8(x), uint8(kk))
-	case 0x5:
-		lsb := instruction & 0x000F
-		if lsb == 0 {
-			c.compareReg(uint8(x), uint8(y))
+	}
+	c.tickTimers()
+	return nil
+}
+
+// TickTimers performs one tick of the 60Hz timer: the delay and sound timers are decremented
+// when they are non-zero, and the buzzer sounds while the sound timer is running.
+func (c *CPU) TickTimers() {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	c.tickTimers()
+}
+
+func (c *CPU) tickTimers() {
+	if c.DT > 0 {
+		c.DT--
+	}
+	c.buzzing = c.ST > 0
+	if c.buzzing {
+		c.audio(c.Audio.Start())
+		c.ST--
+	} else {
+		c.audio(c.Audio.Stop())
+	}
+	if c.Hooks.Tick != nil {
+		c.Hooks.Tick()
+	}
+}
+
+// Halted reports whether the CPU stopped executing instructions, either because the program exited with 00FD
+// or because an instruction failed while running with Start.
+func (c *CPU) Halted() bool {
+	return c.halted.Load()
+}
+
+// Errors returns the channel the error that halted the CPU started with Start is sent to.
+func (c *CPU) Errors() <-chan error {
+	return c.errCh
+}
+
+// Step fetches and executes a single instruction.
+func (c *CPU) Step() error {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	return c.step()
+}
+
+func (c *CPU) step() error {
+	if c.halted.Load() {
+		return nil
+	}
+	if c.Hooks.BeforeStep != nil {
+		if err := c.Hooks.BeforeStep(); err != nil {
+			return err
 		}
-	case 0x6:
-		c.setValue(uint8(x), uint8(kk))
-	case 0x7:
-		c.addValue(uint8(x), uint8(kk))
-	case 0x8:
-		switch ((instruction & 0x000F) << 12) >> 12 {
-		case 0x0:
-			c.store(uint8(x), uint8(y))
-		case 0x1:
-			c.or(uint8(x), uint8(y))
-		case 0x2:
-			c.and(uint8(x), uint8(y))
-		case 0x3:
-			c.xor(uint8(x), uint8(y))
-		case 0x4:
-			c.sum(uint8(x), uint8(y))
-		case 0x5:
-			c.sub(uint8(x), uint8(y))
-		case 0x6:
-			c.shr(uint8(x))
-		case 0x7:
-			c.subn(uint8(x), uint8(y))
-		case 0xE:
-			c.shl(uint8(x))
-		default:
-			panic("instruction not recognized")
+	}
+	instruction, err := c.Fetch()
+	if err == nil {
+		err = c.DecodeAndExecute(instruction)
+	}
+	if err != nil {
+		// PC is left at the failing instruction, so that it can be inspected and executed again.
+		c.PC = c.opPC
+		if c.Hooks.Error != nil {
+			return c.Hooks.Error(err)
 		}
-	case 0x9:
-		c.sne(uint8(x), uint8(y))
-	case 0xA:
+		return err
+	}
+	if c.Hooks.AfterStep != nil {
+		return c.Hooks.AfterStep()
+	}
+	return nil
+}
+
+func (c *CPU) Fetch() (uint16, error) {
+	c.opPC = c.PC
+	msb, err := c.fetchMemory(int(c.PC))
+	if err != nil {
+		return 0, err
+	}
+	lsb, err := c.fetchMemory(int(c.PC) + 1)
+	if err != nil {
+		return 0, err
+	}
+	c.PC += 2
+	return uint16(msb)<<8 | uint16(lsb), nil
+}
+
+// DecodeAndExecute executes an instruction which has just been fetched, so PC points to the next one.
+func (c *CPU) DecodeAndExecute(instruction uint16) error {
+	c.opPC = c.PC - 2
+	in := opcode.Decode(instruction)
+	x, y, n, kk, nnn := in.X, in.Y, in.N, in.KK, in.NNN
+
+	switch in.Op {
+	case opcode.CLS:
+		c.clearScreen()
+	case opcode.RET:
+		return c.ret()
+	case opcode.SCD:
+		c.scrollDown(n)
+	case opcode.SCU:
+		c.scrollUp(n)
+	case opcode.SCR:
+		c.scrollRight()
+	case opcode.SCL:
+		c.scrollLeft()
+	case opcode.EXIT:
+		c.exit()
+	case opcode.LOW:
+		c.lores()
+	case opcode.HIGH:
+		c.hires()
+	case opcode.JP:
+		c.jump(nnn)
+	case opcode.CALL:
+		return c.call(nnn)
+	case opcode.SEVxByte:
+		c.skipIfEqual(x, kk)
+	case opcode.SNEVxByte:
+		c.skipIfNotEqual(x, kk)
+	case opcode.SEVxVy:
+		c.compareReg(x, y)
+	case opcode.SaveRange:
+		return c.storeVRangeToMemory(x, y)
+	case opcode.LoadRange:
+		return c.loadMemoryToVRange(x, y)
+	case opcode.LDVxByte:
+		c.setValue(x, kk)
+	case opcode.ADDVxByte:
+		c.addValue(x, kk)
+	case opcode.LDVxVy:
+		c.store(x, y)
+	case opcode.OR:
+		c.or(x, y)
+	case opcode.AND:
+		c.and(x, y)
+	case opcode.XOR:
+		c.xor(x, y)
+	case opcode.ADDVxVy:
+		c.sum(x, y)
+	case opcode.SUB:
+		c.sub(x, y)
+	case opcode.SHR:
+		c.shr(x, y)
+	case opcode.SUBN:
+		c.subn(x, y)
+	case opcode.SHL:
+		c.shl(x, y)
+	case opcode.SNEVxVy:
+		c.sne(x, y)
+	case opcode.LDI:
 		c.setI(nnn)
-	case 0xB:
-		c.jumpFromV0(nnn)
-	case 0xC:
-		c.rnd(uint8(x), uint8(kk))
-	case 0xD:
-		c.drw(uint8(x), uint8(y), uint8(n))
-	case 0xE:
-		switch ((instruction & 0x00FF) << 8) >> 8 {
-		case 0x9E:
-			c.skipIfKeyPressed(uint8(x))
-		case 0xA1:
-			c.skipIfKeyNotPressed(uint8(x))
-		default:
-			panic("instruction not recognized")
-		}
-	case 0xF:
-		switch ((instruction & 0x00FF) << 8) >> 8 {
-		case 0x07:
-			c.storeDelayTimerToRegister(uint8(x))
-		case 0x0A:
-			c.waitKeyPressedAndStoreToRegister(uint8(x))
-		case 0x15:
-			c.setDelayTimerFromRegister(uint8(x))
-		case 0x18:
-			c.setSoundTimerFromRegister(uint8(x))
-		case 0x1E:
-			c.addIWithV(uint8(x))
-		case 0x29:
-			c.setIWithSpriteLocationOfRegisterVal(uint8(x))
-		case 0x33:
-			c.storeBCD(uint8(x))
-		case 0x55:
-			c.storeVRegisterToMemory(uint8(x))
-		case 0x65:
-			c.loadMemoryToVRegister(uint8(x))
-		default:
-			panic(fmt.Sprintf("instruction not recognized %x", instruction))
-		}
+	case opcode.JPV0:
+		c.jumpFromV0(x, nnn)
+	case opcode.RND:
+		c.rnd(x, kk)
+	case opcode.DRW:
+		return c.drw(x, y, n)
+	case opcode.SKP:
+		c.skipIfKeyPressed(x)
+	case opcode.SKNP:
+		c.skipIfKeyNotPressed(x)
+	case opcode.LDILong:
+		return c.setILong()
+	case opcode.PLANE:
+		c.selectPlanes(x)
+	case opcode.AUDIO:
+		return c.loadAudioPattern()
+	case opcode.LDVxDT:
+		c.storeDelayTimerToRegister(x)
+	case opcode.LDVxK:
+		c.waitKeyPressedAndStoreToRegister(x)
+	case opcode.LDDTVx:
+		c.setDelayTimerFromRegister(x)
+	case opcode.LDSTVx:
+		c.setSoundTimerFromRegister(x)
+	case opcode.ADDIVx:
+		c.addIWithV(x)
+	case opcode.LDFVx:
+		c.setIWithSpriteLocationOfRegisterVal(x)
+	case opcode.LDHFVx:
+		c.setIWithBigSpriteLocationOfRegisterVal(x)
+	case opcode.LDBVx:
+		return c.storeBCD(x)
+	case opcode.PITCH:
+		c.setPitch(x)
+	case opcode.LDIVx:
+		return c.storeVRegisterToMemory(x)
+	case opcode.LDVxI:
+		return c.loadMemoryToVRegister(x)
+	case opcode.LDRVx:
+		c.storeVRegisterToFlags(x)
+	case opcode.LDVxR:
+		c.loadFlagsToVRegister(x)
 	default:
-		panic("instruction not recognized")
+		return ErrUnknownOpcode{PC: c.opPC, Opcode: instruction}
 	}
-
+	return nil
 }
 
 // clearScreen Clear the display.
@@ -273,14 +549,78 @@ func (c *CPU) clearScreen() {
 	c.Display.Draw()
 }
 
+// scrollDown Scrolls the display down by n pixels.
+// 00Cn - SCD nibble
+func (c *CPU) scrollDown(n uint8) {
+	log.Debug().Msgf("00Cn - SCD nibble")
+	c.Display.ScrollDown(n)
+	c.Display.Draw()
+}
+
+// scrollUp Scrolls the display up by n pixels.
+// 00Dn - SCU nibble
+func (c *CPU) scrollUp(n uint8) {
+	log.Debug().Msgf("00Dn - SCU nibble")
+	c.Display.ScrollUp(n)
+	c.Display.Draw()
+}
+
+// scrollRight Scrolls the display right by 4 pixels.
+// 00FB - SCR
+func (c *CPU) scrollRight() {
+	log.Debug().Msgf("00FB - SCR")
+	c.Display.ScrollRight(4)
+	c.Display.Draw()
+}
+
+// scrollLeft Scrolls the display left by 4 pixels.
+// 00FC - SCL
+func (c *CPU) scrollLeft() {
+	log.Debug().Msgf("00FC - SCL")
+	c.Display.ScrollLeft(4)
+	c.Display.Draw()
+}
+
+// exit Exits the interpreter. The CPU stops executing instructions.
+// 00FD - EXIT
+func (c *CPU) exit() {
+	log.Debug().Msgf("00FD - EXIT")
+	c.halted.Store(true)
+}
+
+// lores Disables the high resolution mode and goes back to 64x32.
+// 00FE - LOW
+func (c *CPU) lores() {
+	log.Debug().Msgf("00FE - LOW")
+	c.Hires = false
+	c.Display.SetResolution(false)
+	c.Display.Draw()
+}
+
+// hires Enables the 128x64 high resolution mode.
+// 00FF - HIGH
+func (c *CPU) hires() {
+	log.Debug().Msgf("00FF - HIGH")
+	c.Hires = true
+	c.Display.SetResolution(true)
+	c.Display.Draw()
+}
+
 // ret Returns from a subroutine.
-// The interpreter sets the program counter to the address at the top of the stack,
-// then subtracts 1 from the stack pointer.
+// The interpreter subtracts 1 from the stack pointer, then sets the program counter
+// to the address at the top of the stack.
 // 00EE - RET
-func (c *CPU) ret() {
+func (c *CPU) ret() error {
 	log.Debug().Msgf("00EE - RET")
-	c.PC = c.Stack[c.SP]
+	if c.SP == 0 {
+		if err := c.violation(c.Protection.StackUnderflow, ErrStackUnderflow{PC: c.opPC}); err != nil {
+			return err
+		}
+		c.SP = uint8(len(c.Stack))
+	}
 	c.SP--
+	c.PC = c.Stack[c.SP]
+	return nil
 }
 
 // Jump to location nnn.
@@ -292,14 +632,21 @@ func (c *CPU) jump(addr uint16) {
 }
 
 // call Calls subroutine at nnn.
-// The interpreter increments the stack pointer, then puts the current PC on the top of the stack.
+// The interpreter puts the current PC on the top of the stack, then increments the stack pointer.
 // The PC is then setValue to nnn.
 // 2nnn - CALL addr
-func (c *CPU) call(addr uint16) {
+func (c *CPU) call(addr uint16) error {
 	log.Debug().Msgf("2nnn - CALL addr")
-	c.SP++
+	if int(c.SP) >= len(c.Stack) {
+		if err := c.violation(c.Protection.StackOverflow, ErrStackOverflow{PC: c.opPC}); err != nil {
+			return err
+		}
+		c.SP = 0
+	}
 	c.Stack[c.SP] = c.PC
+	c.SP++
 	c.PC = addr
+	return nil
 }
 
 // skipIfEqual Skip next instruction if Vx = kk.
@@ -308,7 +655,7 @@ func (c *CPU) call(addr uint16) {
 func (c *CPU) skipIfEqual(regAddr uint8, val uint8) {
 	log.Debug().Msgf("3xkk - SE Vx, byte")
 	if c.V[regAddr] == val {
-		c.PC += 2
+		c.skip()
 	}
 }
 
@@ -318,7 +665,7 @@ func (c *CPU) skipIfEqual(regAddr uint8, val uint8) {
 func (c *CPU) skipIfNotEqual(regAddr uint8, val uint8) {
 	log.Debug().Msgf("4xkk - SNE Vx, byte")
 	if c.V[regAddr] != val {
-		c.PC += 2
+		c.skip()
 	}
 }
 
@@ -329,8 +676,50 @@ func (c *CPU) skipIfNotEqual(regAddr uint8, val uint8) {
 func (c *CPU) compareReg(xRegAddr, yRegAddr uint8) {
 	log.Debug().Msgf("5xy0 - SE Vx, Vy")
 	if c.V[xRegAddr] == c.V[yRegAddr] {
-		c.PC += 2
+		c.skip()
+	}
+}
+
+// storeVRangeToMemory Stores registers Vx through Vy in memory starting at location I.
+// The registers are stored in reverse order when x is greater than y. I is not modified.
+// 5xy2 - LD [I], Vx-Vy
+func (c *CPU) storeVRangeToMemory(xRegAddr, yRegAddr uint8) error {
+	log.Debug().Msgf("5xy2 - LD [I], Vx-Vy")
+	for i, reg := range registerRange(xRegAddr, yRegAddr) {
+		if err := c.writeMemory(int(c.I)+i, c.V[reg]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMemoryToVRange Reads registers Vx through Vy from memory starting at location I.
+// The registers are read in reverse order when x is greater than y. I is not modified.
+// 5xy3 - LD Vx-Vy, [I]
+func (c *CPU) loadMemoryToVRange(xRegAddr, yRegAddr uint8) error {
+	log.Debug().Msgf("5xy3 - LD Vx-Vy, [I]")
+	for i, reg := range registerRange(xRegAddr, yRegAddr) {
+		val, err := c.readMemory(int(c.I) + i)
+		if err != nil {
+			return err
+		}
+		c.V[reg] = val
 	}
+	return nil
+}
+
+func registerRange(from, to uint8) []uint8 {
+	var regs []uint8
+	if from <= to {
+		for r := int(from); r <= int(to); r++ {
+			regs = append(regs, uint8(r))
+		}
+	} else {
+		for r := int(from); r >= int(to); r-- {
+			regs = append(regs, uint8(r))
+		}
+	}
+	return regs
 }
 
 // setValue Sets Vx = kk.
@@ -365,6 +754,9 @@ func (c *CPU) store(destAddr, srcAddr uint8) {
 func (c *CPU) or(xRegAddr, yRegAddr uint8) {
 	log.Debug().Msgf("8xy1 - OR Vx, Vy")
 	c.V[xRegAddr] |= c.V[yRegAddr]
+	if c.Quirks.LogicResetsVF {
+		c.V[0xF] = 0
+	}
 }
 
 // Set Vx = Vx AND Vy.
@@ -375,6 +767,9 @@ func (c *CPU) or(xRegAddr, yRegAddr uint8) {
 func (c *CPU) and(xRegAddr, yRegAddr uint8) {
 	log.Debug().Msgf("8xy2 - AND Vx, Vy")
 	c.V[xRegAddr] &= c.V[yRegAddr]
+	if c.Quirks.LogicResetsVF {
+		c.V[0xF] = 0
+	}
 }
 
 // Set Vx = Vx XOR Vy.
@@ -385,6 +780,9 @@ func (c *CPU) and(xRegAddr, yRegAddr uint8) {
 func (c *CPU) xor(xRegAddr, yRegAddr uint8) {
 	log.Debug().Msgf("8xy3 - XOR Vx, Vy")
 	c.V[xRegAddr] ^= c.V[yRegAddr]
+	if c.Quirks.LogicResetsVF {
+		c.V[0xF] = 0
+	}
 }
 
 // Set Vx = Vx + Vy, setValue VF = carry.
@@ -420,11 +818,16 @@ func (c *CPU) sub(xRegAddr, yRegAddr uint8) {
 // Set Vx = Vx SHR 1.
 // If the least-significant bit of Vx is 1, then VF is set to 1, otherwise 0.
 // Then Vx is divided by 2.
+// With the ShiftUsesVY quirk, Vy is shifted instead and the result is stored in Vx.
 // 8xy6 - SHR Vx {, Vy}
-func (c *CPU) shr(addr uint8) {
+func (c *CPU) shr(xRegAddr, yRegAddr uint8) {
 	log.Debug().Msgf("8xy6 - SHR Vx {, Vy}")
-	c.V[0xF] = c.V[addr] & 0x01
-	c.V[addr] = c.V[addr] >> 1
+	val := c.V[xRegAddr]
+	if c.Quirks.ShiftUsesVY {
+		val = c.V[yRegAddr]
+	}
+	c.V[xRegAddr] = val >> 1
+	c.V[0xF] = val & 0x01
 }
 
 // Set Vx = Vy - Vx, set VF = NOT borrow.
@@ -444,11 +847,26 @@ func (c *CPU) subn(xRegAddr, yRegAddr uint8) {
 // Set Vx = Vx SHL 1.
 // If the most-significant bit of Vx is 1, then VF is set to 1, otherwise to 0.
 // Then Vx is multiplied by 2.
+// With the ShiftUsesVY quirk, Vy is shifted instead and the result is stored in Vx.
 // 8xyE - SHL Vx {, Vy}
-func (c *CPU) shl(addr uint8) {
+func (c *CPU) shl(xRegAddr, yRegAddr uint8) {
 	log.Debug().Msgf("8xyE - SHL Vx {, Vy}")
-	c.V[0xF] = (c.V[addr] & 0x80) >> 7
-	c.V[addr] = c.V[addr] << 1
+	val := c.V[xRegAddr]
+	if c.Quirks.ShiftUsesVY {
+		val = c.V[yRegAddr]
+	}
+	c.V[xRegAddr] = val << 1
+	c.V[0xF] = (val & 0x80) >> 7
+}
+
+// skip Skips the next instruction.
+// The XO-CHIP F000 nnnn instruction is 4 bytes long, so it is skipped entirely.
+func (c *CPU) skip() {
+	if int(c.PC)+1 < len(c.Memory) && c.Memory[c.PC] == 0xF0 && c.Memory[c.PC+1] == 0x00 {
+		c.PC += 4
+		return
+	}
+	c.PC += 2
 }
 
 // Skip next instruction if Vx != Vy.
@@ -458,7 +876,7 @@ func (c *CPU) shl(addr uint8) {
 func (c *CPU) sne(xRegAddr, yRegAddr uint8) {
 	log.Debug().Msgf("9xy0 - SNE Vx, Vy")
 	if c.V[xRegAddr] != c.V[yRegAddr] {
-		c.PC += 2
+		c.skip()
 	}
 }
 
@@ -472,9 +890,14 @@ func (c *CPU) setI(addr uint16) {
 
 // Jump to location nnn + V0.
 // The program counter is set to nnn plus the value of V0.
+// With the JumpUsesVX quirk, the instruction is read as Bxnn and jumps to xnn plus the value of Vx.
 // Bnnn - JP V0, addr
-func (c *CPU) jumpFromV0(addr uint16) {
+func (c *CPU) jumpFromV0(regAddr uint8, addr uint16) {
 	log.Debug().Msgf("Bnnn - JP V0, addr")
+	if c.Quirks.JumpUsesVX {
+		c.PC = uint16(c.V[regAddr]) + addr
+		return
+	}
 	c.PC = uint16(c.V[0x0]) + addr
 }
 
@@ -485,7 +908,12 @@ func (c *CPU) jumpFromV0(addr uint16) {
 // Cxkk - RND Vx, byte
 func (c *CPU) rnd(addr uint8, val uint8) {
 	log.Debug().Msgf("Cxkk - RND Vx, byte")
-	num := uint8(rand.Intn(256))
+	var num uint8
+	if c.Rand != nil {
+		num = uint8(c.Rand.Intn(256))
+	} else {
+		num = uint8(rand.Intn(256))
+	}
 	c.V[addr] = num & val
 }
 
@@ -493,42 +921,72 @@ func (c *CPU) rnd(addr uint8, val uint8) {
 // The interpreter reads n bytes from memory, starting at the address stored in I.
 // These bytes are then displayed as sprites on screen at coordinates (Vx, Vy).
 // Sprites are XORed onto the existing screen. If this causes any pixels to be erased, VF is set to 1,
-// otherwise it is set to 0. If the sprite is positioned so part of it is outside the coordinates of the display,
-// it wraps around to the opposite side of the screen.
+// otherwise it is set to 0. The starting position always wraps around the screen. If the sprite is positioned
+// so part of it is outside the coordinates of the display, that part is clipped, or wraps around to the
+// opposite side of the screen with the WrapSprites quirk.
+// When n is 0, a SUPER-CHIP 16x16 sprite made of 32 bytes, two per row, is drawn instead.
 // See instruction 8xy3 for more information on XOR, and section 2.4, Display, for more information on the Chip-8
 // screen and sprites.
 // Dxyn - DRW Vx, Vy, nibble
-func (c *CPU) drw(xRegAddr, yRegAddr, nibble uint8) {
+func (c *CPU) drw(xRegAddr, yRegAddr, nibble uint8) error {
 	log.Debug().Msgf("Dxyn - DRW %x, %x, %x", xRegAddr, yRegAddr, nibble)
-	maxX := c.Display.W - 1
-	maxY := c.Display.H - 1
+	w := int(c.Display.W)
+	h := int(c.Display.H)
 
-	x := c.V[xRegAddr] % maxX
-	y := c.V[yRegAddr] % maxY
+	x := int(c.V[xRegAddr]) % w
+	y := int(c.V[yRegAddr]) % h
 	c.V[0xF] = 0
 
-	for i := 0; i < int(nibble); i++ {
-		nthByte := c.Memory[c.I+uint16(i)]
-		for j := 7; j >= 0; j-- {
-
-			screenX := x + uint8(7-j)
-			screenY := y + uint8(i)
-
-			spritePixel := (nthByte >> j) & 0x01
-			screenPixel := c.Display.GetPixel(screenX, screenY)
-
-			if screenX > maxX || screenY > maxY {
-				continue
+	spriteW, rows := 8, int(nibble)
+	if nibble == 0 {
+		spriteW, rows = 16, 16
+	}
+	bytesPerRow := spriteW / 8
+
+	// With XO-CHIP bitplanes, one sprite is drawn in every selected plane,
+	// each reading the bytes following the sprite of the previous plane.
+	addr := int(c.I)
+	for plane := uint8(0x1); plane <= 0x2; plane <<= 1 {
+		if c.Display.Planes()&plane == 0 {
+			continue
+		}
+		for i := 0; i < rows; i++ {
+			var row uint16
+			for b := 0; b < bytesPerRow; b++ {
+				val, err := c.readMemory(addr + i*bytesPerRow + b)
+				if err != nil {
+					return err
+				}
+				row = row<<8 | uint16(val)
 			}
-
-			newVal := spritePixel ^ screenPixel
-			if spritePixel == 1 && screenPixel == 1 {
-				c.V[0xF] = 1
+			for j := spriteW - 1; j >= 0; j-- {
+
+				screenX := x + (spriteW - 1 - j)
+				screenY := y + i
+
+				if screenX >= w || screenY >= h {
+					if !c.Quirks.WrapSprites {
+						continue
+					}
+					screenX %= w
+					screenY %= h
+				}
+
+				spritePixel := uint8(row>>j) & 0x01
+				if spritePixel == 0 {
+					continue
+				}
+				screenPixel := c.Display.GetPixel(uint8(screenX), uint8(screenY))
+				if screenPixel&plane != 0 {
+					c.V[0xF] = 1
+				}
+				c.Display.SetPixel(uint8(screenX), uint8(screenY), screenPixel^plane)
 			}
-			c.Display.SetPixel(screenX, screenY, newVal)
 		}
+		addr += rows * bytesPerRow
 	}
 	c.Display.Draw()
+	return nil
 }
 
 // Skip next instruction if key with the value of Vx is pressed.
@@ -538,7 +996,7 @@ func (c *CPU) drw(xRegAddr, yRegAddr, nibble uint8) {
 func (c *CPU) skipIfKeyPressed(addr uint8) {
 	log.Debug().Msgf("Ex9E - SKP Vx")
 	if c.Keyboard.IsBeingPressed(c.V[addr]) {
-		c.PC += 2
+		c.skip()
 	}
 }
 
@@ -549,17 +1007,28 @@ func (c *CPU) skipIfKeyPressed(addr uint8) {
 func (c *CPU) skipIfKeyNotPressed(addr uint8) {
 	log.Debug().Msgf("ExA1 - SKNP Vx")
 	if !c.Keyboard.IsBeingPressed(c.V[addr]) {
-		c.PC += 2
+		c.skip()
 	}
 }
 
 // Wait for a key press, store the value of the key in Vx.
 // All execution stops until a key is pressed, then the value of that key is stored in Vx.
+// Rather than blocking, the instruction is executed again until a key pressed after it started is received,
+// so the timers keep running meanwhile.
 // Fx0A - LD Vx, K
 func (c *CPU) waitKeyPressedAndStoreToRegister(addr uint8) {
 	log.Debug().Msgf("Fx0A - LD Vx, K")
-	key := <-c.Keyboard.PressedEventCh()
-	c.V[addr] = key
+	if !c.waitingKey {
+		c.waitingKey = true
+		c.Keyboard.DiscardPressedEvents()
+	}
+	select {
+	case key := <-c.Keyboard.PressedEventCh():
+		c.waitingKey = false
+		c.V[addr] = key
+	default:
+		c.PC = c.opPC
+	}
 }
 
 // Set Vx = delay delayTimer value.
@@ -570,6 +1039,58 @@ func (c *CPU) storeDelayTimerToRegister(addr uint8) {
 	c.V[addr] = c.DT
 }
 
+// Set I = nnnn.
+// The 16-bit address in the two bytes following the instruction is loaded into I.
+// F000 nnnn - LD I, long addr
+func (c *CPU) setILong() error {
+	log.Debug().Msgf("F000 nnnn - LD I, long addr")
+	msb, err := c.fetchMemory(int(c.PC))
+	if err != nil {
+		return err
+	}
+	lsb, err := c.fetchMemory(int(c.PC) + 1)
+	if err != nil {
+		return err
+	}
+	c.I = uint16(msb)<<8 | uint16(lsb)
+	c.PC += 2
+	return nil
+}
+
+// Select the drawing planes.
+// n is a bitmask of the XO-CHIP planes later drawing, clearing and scrolling instructions work on.
+// Fn01 - PLANE n
+func (c *CPU) selectPlanes(mask uint8) {
+	log.Debug().Msgf("Fn01 - PLANE n")
+	c.Display.SelectPlanes(mask)
+}
+
+// Load the audio pattern.
+// The 16 bytes starting at I are loaded into the audio pattern buffer.
+// F002 - AUDIO
+func (c *CPU) loadAudioPattern() error {
+	log.Debug().Msgf("F002 - AUDIO")
+	var pattern [16]uint8
+	for i := range pattern {
+		val, err := c.readMemory(int(c.I) + i)
+		if err != nil {
+			return err
+		}
+		pattern[i] = val
+	}
+	c.pattern, c.hasPattern = pattern, true
+	c.Audio.SetPattern(pattern)
+	return nil
+}
+
+// Set the audio pitch = Vx.
+// Fx3A - PITCH Vx
+func (c *CPU) setPitch(addr uint8) {
+	log.Debug().Msgf("Fx3A - PITCH Vx")
+	c.pitch = c.V[addr]
+	c.Audio.SetPitch(c.pitch)
+}
+
 // Set delay delayTimer = Vx.
 // DT is set equal to the value of Vx.
 // Fx15 - LD DT, Vx
@@ -602,7 +1123,15 @@ func (c *CPU) addIWithV(addr uint8) {
 func (c *CPU) setIWithSpriteLocationOfRegisterVal(addr uint8) {
 	log.Debug().Msgf("Fx29 - LD F, Vx")
 	key := c.V[addr] & 0x0F
-	c.I = 0x050 + uint16(key*5)
+	c.I = fontStartAddr + uint16(key)*5
+}
+
+// Set I = location of the 8x10 sprite for digit Vx.
+// Fx30 - LD HF, Vx
+func (c *CPU) setIWithBigSpriteLocationOfRegisterVal(addr uint8) {
+	log.Debug().Msgf("Fx30 - LD HF, Vx")
+	key := c.V[addr] & 0x0F
+	c.I = bigFontStartAddr + uint16(key)*10
 }
 
 // Store BCD representation of Vx in memory locations I, I+1, and I+2.
@@ -610,36 +1139,80 @@ func (c *CPU) setIWithSpriteLocationOfRegisterVal(addr uint8) {
 // in memory at location in I, the tens digit at location I+1,
 // and the ones digit at location I+2.
 // Fx33 - LD B, Vx
-func (c *CPU) storeBCD(addr uint8) {
+func (c *CPU) storeBCD(addr uint8) error {
 	log.Debug().Msgf("Fx33 - LD B, Vx")
 	val := c.V[addr]
-
-	var iOffset uint16 = 2
-	for val != 0 {
-		modulo := val % 10
-		val = val / 10
-
-		c.Memory[c.I+iOffset] = modulo
-		iOffset--
+	digits := []uint8{val / 100, val / 10 % 10, val % 10}
+	for i, d := range digits {
+		if err := c.writeMemory(int(c.I)+i, d); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // Store registers V0 through Vx in memory starting at location I.
 // The interpreter copies the values of registers V0 through Vx into memory, starting at the address in I.
+// I is then updated according to the LoadStoreIncrement quirk.
 // Fx55 - LD [I], Vx
-func (c *CPU) storeVRegisterToMemory(maxAddr uint8) {
+func (c *CPU) storeVRegisterToMemory(maxAddr uint8) error {
 	log.Debug().Msgf("Fx55 - LD [I], Vx")
 	for i := 0; i <= int(maxAddr); i++ {
-		c.Memory[c.I+uint16(i)] = c.V[i]
+		if err := c.writeMemory(int(c.I)+i, c.V[i]); err != nil {
+			return err
+		}
 	}
+	c.incrementIAfterLoadStore(maxAddr)
+	return nil
 }
 
 // Read registers V0 through Vx from memory starting at location I.
 // The interpreter reads values from memory starting at location I into registers V0 through Vx.
+// I is then updated according to the LoadStoreIncrement quirk.
 // Fx65 - LD Vx, [I]
-func (c *CPU) loadMemoryToVRegister(maxAddr uint8) {
+func (c *CPU) loadMemoryToVRegister(maxAddr uint8) error {
 	log.Debug().Msgf("Fx65 - LD Vx, [I]")
 	for i := 0; i <= int(maxAddr); i++ {
-		c.V[i] = c.Memory[c.I+uint16(i)]
+		val, err := c.readMemory(int(c.I) + i)
+		if err != nil {
+			return err
+		}
+		c.V[i] = val
+	}
+	c.incrementIAfterLoadStore(maxAddr)
+	return nil
+}
+
+func (c *CPU) incrementIAfterLoadStore(maxAddr uint8) {
+	switch c.Quirks.LoadStoreIncrement {
+	case IncrementX:
+		c.I += uint16(maxAddr)
+	case IncrementXPlusOne:
+		c.I += uint16(maxAddr) + 1
+	}
+}
+
+// Store registers V0 through Vx in the RPL user flags.
+// If a flags file has been set, the flags are also written to it so that they survive the next run.
+// Fx75 - LD R, Vx
+func (c *CPU) storeVRegisterToFlags(maxAddr uint8) {
+	log.Debug().Msgf("Fx75 - LD R, Vx")
+	for i := 0; i <= int(maxAddr); i++ {
+		c.RPL[i] = c.V[i]
+	}
+	if c.flagsPath == "" {
+		return
+	}
+	if err := os.WriteFile(c.flagsPath, c.RPL[:], 0644); err != nil {
+		log.Error().Err(err).Msg("unable to persist flags")
+	}
+}
+
+// Read registers V0 through Vx from the RPL user flags.
+// Fx85 - LD Vx, R
+func (c *CPU) loadFlagsToVRegister(maxAddr uint8) {
+	log.Debug().Msgf("Fx85 - LD Vx, R")
+	for i := 0; i <= int(maxAddr); i++ {
+		c.V[i] = c.RPL[i]
 	}
 }
@@ -0,0 +1,766 @@
+// Package dap serves the Debug Adapter Protocol for the CHIP-8 CPU, so that editors can run and debug ROMs,
+// showing the Octo source they were assembled from.
+//
+// The source lines are found with the line map written by the assembler, see asm.LineMap. Programs without
+// a line map are debugged at the instruction level, with the disassembly.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/asm"
+	"github.com/imrenagi/chip8/disasm"
+)
+
+// threadID is the only thread of the program.
+const threadID = 1
+
+// The references of the scopes shown in the variables view.
+const (
+	registersRef = 1 + iota
+	stackRef
+	timersRef
+)
+
+// LaunchArguments are the arguments of the launch request.
+type LaunchArguments struct {
+	// Program is the ROM to run, or an Octo source (.8o) which is assembled first.
+	Program string `json:"program"`
+	// LineMap is the line map of the ROM. It defaults to the ROM with the .lines extension.
+	LineMap string `json:"lineMap"`
+	// Quirks is the name of the quirks profile, see chip8.QuirksPresets. It defaults to legacy.
+	Quirks string `json:"quirks"`
+	// StopOnEntry pauses the program before its first instruction.
+	StopOnEntry bool `json:"stopOnEntry"`
+}
+
+// Launcher creates the CPU running the program at path, e.g. with a window showing its display. The
+// program is loaded by the Server, which also starts the CPU.
+type Launcher func(path string, quirks chip8.Quirks) (*chip8.CPU, error)
+
+// Server serves a debugging session.
+type Server struct {
+	launch Launcher
+
+	wmu sync.Mutex
+	w   io.Writer
+	seq int
+
+	// Set by the launch request.
+	cpu         *chip8.CPU
+	lines       *asm.LineMap
+	symbols     asm.Symbols
+	stopOnEntry bool
+	cancel      context.CancelFunc
+	// done is closed once the CPU has stopped, closing its display and audio sink.
+	done chan struct{}
+
+	mu          sync.Mutex
+	breakpoints map[uint16]bool
+	resumption  chip8.Resumption
+	interrupt   bool
+	// until stops the execution after the instruction for which it returns true. It implements stepping.
+	until func() bool
+	// err is the error the program stopped at.
+	err error
+}
+
+// NewServer returns a Server creating the CPU with launch.
+func NewServer(launch Launcher) *Server {
+	return &Server{
+		launch:      launch,
+		symbols:     asm.Symbols{},
+		breakpoints: map[uint16]bool{},
+	}
+}
+
+// Serve reads the requests from r and writes the responses and events to w until the client disconnects,
+// r is closed or ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		if s.done != nil {
+			<-s.done
+		}
+	}()
+	s.w = w
+	s.cancel = cancel
+
+	requests := make(chan *request)
+	readErr := make(chan error, 1)
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			req, err := readMessage(br)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case req := <-requests:
+			if err := s.handle(ctx, req); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) send(msg interface{}) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	switch m := msg.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+	return writeMessage(s.w, msg)
+}
+
+func (s *Server) respond(req *request, body interface{}) error {
+	return s.send(&response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+func (s *Server) fail(req *request, err error) error {
+	return s.send(&response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: err.Error()})
+}
+
+func (s *Server) event(name string, body interface{}) error {
+	return s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+// handle handles a request. Only the errors writing to the client are returned, the others fail the request.
+func (s *Server) handle(ctx context.Context, req *request) error {
+	if s.cpu == nil {
+		switch req.Command {
+		case "initialize", "launch", "disconnect", "terminate":
+		default:
+			return s.fail(req, errors.New("no program is launched"))
+		}
+	}
+
+	switch req.Command {
+	case "initialize":
+		return s.respond(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsReadMemoryRequest":        true,
+			"supportsDisassembleRequest":       true,
+			"supportsExceptionInfoRequest":     true,
+			"supportsSteppingGranularity":      true,
+			"supportsTerminateRequest":         true,
+		})
+	case "launch":
+		var args LaunchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return s.fail(req, err)
+		}
+		if err := s.start(ctx, args); err != nil {
+			return s.fail(req, err)
+		}
+		if err := s.respond(req, nil); err != nil {
+			return err
+		}
+		// The breakpoints can be set now that the line map is known.
+		return s.event("initialized", nil)
+	case "setBreakpoints":
+		return s.setBreakpoints(req)
+	case "setExceptionBreakpoints":
+		// The program always stops at the errors.
+		return s.respond(req, map[string]interface{}{})
+	case "configurationDone":
+		if err := s.respond(req, nil); err != nil {
+			return err
+		}
+		if s.stopOnEntry {
+			return s.stopped("entry", "")
+		}
+		s.resume(nil)
+		return nil
+	case "threads":
+		return s.respond(req, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "CHIP-8"}},
+		})
+	case "stackTrace":
+		return s.stackTrace(req)
+	case "scopes":
+		return s.respond(req, map[string]interface{}{"scopes": []scope{
+			{Name: "Registers", VariablesReference: registersRef},
+			{Name: "Stack", VariablesReference: stackRef},
+			{Name: "Timers", VariablesReference: timersRef},
+		}})
+	case "variables":
+		return s.variables(req)
+	case "evaluate":
+		return s.evaluate(req)
+	case "continue":
+		s.resume(nil)
+		return s.respond(req, map[string]interface{}{"allThreadsContinued": true})
+	case "next", "stepIn", "stepOut":
+		return s.step(req)
+	case "pause":
+		if err := s.respond(req, nil); err != nil {
+			return err
+		}
+		if s.cpu.Paused() {
+			return s.stopped("pause", "")
+		}
+		s.mu.Lock()
+		s.interrupt = true
+		s.mu.Unlock()
+		return nil
+	case "exceptionInfo":
+		s.mu.Lock()
+		err := s.err
+		s.mu.Unlock()
+		if err == nil {
+			return s.fail(req, errors.New("the program did not stop at an error"))
+		}
+		return s.respond(req, map[string]interface{}{
+			"exceptionId": strings.TrimPrefix(fmt.Sprintf("%T", err), "chip8."),
+			"description": err.Error(),
+			"breakMode":   "always",
+		})
+	case "readMemory":
+		return s.readMemory(req)
+	case "disassemble":
+		return s.disassemble(req)
+	case "disconnect", "terminate":
+		err := s.respond(req, nil)
+		s.cancel()
+		return err
+	}
+	return s.fail(req, fmt.Errorf("unsupported request %q", req.Command))
+}
+
+// start loads the program into a new CPU and starts it paused.
+func (s *Server) start(ctx context.Context, args LaunchArguments) error {
+	if s.cpu != nil {
+		return errors.New("a program is already launched")
+	}
+	quirksName := args.Quirks
+	if quirksName == "" {
+		quirksName = "legacy"
+	}
+	quirks, ok := chip8.QuirksPresets[quirksName]
+	if !ok {
+		return fmt.Errorf("unknown quirks profile %q", quirksName)
+	}
+	program, err := s.load(args)
+	if err != nil {
+		return err
+	}
+
+	cpu, err := s.launch(args.Program, quirks)
+	if err != nil {
+		return err
+	}
+	if err := cpu.LoadProgramBytes(program); err != nil {
+		return err
+	}
+	cpu.Hooks.BeforeStep = s.beforeStep
+	cpu.Hooks.AfterStep = s.afterStep
+	cpu.Hooks.Error = s.error
+	cpu.Pause()
+	s.cpu = cpu
+	s.stopOnEntry = args.StopOnEntry
+	s.done = make(chan struct{})
+	go func() {
+		cpu.Start(ctx)
+		close(s.done)
+	}()
+	go s.watchExit(ctx)
+	return nil
+}
+
+// load returns the program to run, assembling it when it is a source, and loads its line map and symbols.
+func (s *Server) load(args LaunchArguments) ([]byte, error) {
+	if strings.EqualFold(filepath.Ext(args.Program), ".8o") {
+		src, err := os.ReadFile(args.Program)
+		if err != nil {
+			return nil, err
+		}
+		program, err := asm.Assemble(args.Program, src)
+		if err != nil {
+			return nil, err
+		}
+		path, err := filepath.Abs(args.Program)
+		if err != nil {
+			return nil, err
+		}
+		s.lines = program.LineMap(path)
+		s.symbols = program.Symbols
+		return program.Bytes, nil
+	}
+
+	program, err := os.ReadFile(args.Program)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(args.Program, filepath.Ext(args.Program))
+	linesPath := args.LineMap
+	if linesPath == "" {
+		linesPath = base + ".lines"
+	}
+	if f, err := os.Open(linesPath); err == nil {
+		s.lines, err = asm.ReadLineMap(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", linesPath, err)
+		}
+	} else if args.LineMap != "" {
+		return nil, err
+	}
+	if f, err := os.Open(base + ".sym"); err == nil {
+		s.symbols, err = asm.ReadSymbols(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s.sym: %w", base, err)
+		}
+	}
+	return program, nil
+}
+
+// watchExit reports the end of the program, when it exits with 00FD.
+func (s *Server) watchExit(ctx context.Context) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.cpu.Halted() {
+				s.event("exited", map[string]interface{}{"exitCode": 0})
+				s.event("terminated", nil)
+				return
+			}
+		}
+	}
+}
+
+// stopped reports that the program stopped.
+func (s *Server) stopped(reason, text string) error {
+	body := map[string]interface{}{
+		"reason":            reason,
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	}
+	if text != "" {
+		body["text"] = text
+		body["description"] = text
+	}
+	return s.event("stopped", body)
+}
+
+func (s *Server) beforeStep() error {
+	s.mu.Lock()
+	interrupt := s.interrupt
+	s.interrupt = false
+	hit := !s.resumption.Skip() && s.breakpoints[s.cpu.PC]
+	s.mu.Unlock()
+
+	switch {
+	case interrupt:
+		s.stopped("pause", "")
+	case hit:
+		s.stopped("breakpoint", "")
+	default:
+		return nil
+	}
+	return chip8.ErrBreak
+}
+
+func (s *Server) afterStep() error {
+	s.mu.Lock()
+	done := s.until != nil && s.until()
+	if done {
+		s.until = nil
+	}
+	s.mu.Unlock()
+	if !done {
+		return nil
+	}
+	s.stopped("step", "")
+	return chip8.ErrBreak
+}
+
+// error stops the program at the failing instruction instead of halting it.
+func (s *Server) error(err error) error {
+	s.mu.Lock()
+	s.err = err
+	s.until = nil
+	s.mu.Unlock()
+	s.stopped("exception", err.Error())
+	return chip8.ErrBreak
+}
+
+// resume continues the program until the instruction for which until returns true, or a breakpoint.
+func (s *Server) resume(until func() bool) {
+	s.mu.Lock()
+	s.resumption.Resume()
+	s.until = until
+	s.err = nil
+	s.mu.Unlock()
+	s.cpu.Resume()
+}
+
+// line returns the source line of the instruction at addr.
+func (s *Server) line(addr uint16) (int, bool) {
+	if s.lines == nil {
+		return 0, false
+	}
+	return s.lines.Line(addr)
+}
+
+type stepArguments struct {
+	Granularity string `json:"granularity"`
+}
+
+// step implements next, stepIn and stepOut. The steps go from a source line to another, or from an
+// instruction to the next one when there is no line map or the instruction granularity is requested.
+func (s *Server) step(req *request) error {
+	var args stepArguments
+	json.Unmarshal(req.Arguments, &args)
+	byInstruction := s.lines == nil || args.Granularity == "instruction"
+
+	var pc uint16
+	var sp uint8
+	s.cpu.Exclusive(func() {
+		pc, sp = s.cpu.PC, s.cpu.SP
+	})
+	startLine, _ := s.line(pc)
+	// moved reports whether the execution reached another line, or the next instruction.
+	moved := func() bool {
+		if byInstruction {
+			return true
+		}
+		line, ok := s.line(s.cpu.PC)
+		return ok && line != startLine
+	}
+
+	var until func() bool
+	switch {
+	case req.Command == "stepOut" && sp > 0:
+		until = func() bool { return s.cpu.SP < sp }
+	case req.Command == "stepIn":
+		until = func() bool { return moved() || s.cpu.SP < sp }
+	default:
+		until = func() bool { return s.cpu.SP <= sp && moved() || s.cpu.SP < sp }
+	}
+	if err := s.respond(req, nil); err != nil {
+		return err
+	}
+	s.resume(until)
+	return nil
+}
+
+type setBreakpointsArguments struct {
+	Source      source             `json:"source"`
+	Breakpoints []sourceBreakpoint `json:"breakpoints"`
+}
+
+func (s *Server) setBreakpoints(req *request) error {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.fail(req, err)
+	}
+	sameSource := s.lines != nil && sameFile(args.Source.Path, s.lines.Source)
+
+	breakpoints := map[uint16]bool{}
+	results := make([]breakpointResult, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		if !sameSource {
+			results[i] = breakpointResult{Line: b.Line, Message: "the program was not assembled from this file"}
+			continue
+		}
+		addr, line, ok := s.lines.Addr(b.Line)
+		if !ok {
+			results[i] = breakpointResult{Line: b.Line, Message: "no code at or after this line"}
+			continue
+		}
+		breakpoints[addr] = true
+		results[i] = breakpointResult{Verified: true, Line: line}
+	}
+
+	// The client sends all the breakpoints of a source, and there is a single source.
+	s.mu.Lock()
+	s.breakpoints = breakpoints
+	s.mu.Unlock()
+	return s.respond(req, map[string]interface{}{"breakpoints": results})
+}
+
+func sameFile(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(ia, ib)
+}
+
+// symbolize returns the name of the closest symbol at or before addr.
+func (s *Server) symbolize(addr uint16) string {
+	name, offset, ok := s.symbols.Nearest(addr)
+	if !ok {
+		return ""
+	}
+	if offset == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s+%d", name, offset)
+}
+
+func (s *Server) stackTrace(req *request) error {
+	var addrs []uint16
+	s.cpu.Exclusive(func() {
+		addrs = append(addrs, s.cpu.PC)
+		for i := int(s.cpu.SP) - 1; i >= 0 && i < len(s.cpu.Stack); i-- {
+			// The stack holds the return addresses, the frames are at the calls.
+			addrs = append(addrs, s.cpu.Stack[i]-2)
+		}
+	})
+
+	frames := make([]stackFrame, len(addrs))
+	for i, addr := range addrs {
+		name := s.symbolize(addr)
+		if name == "" {
+			name = fmt.Sprintf("0x%04X", addr)
+		}
+		frames[i] = stackFrame{
+			ID:                          i,
+			Name:                        name,
+			Column:                      1,
+			InstructionPointerReference: fmt.Sprintf("0x%04X", addr),
+		}
+		if line, ok := s.line(addr); ok {
+			frames[i].Line = line
+			frames[i].Source = &source{Name: filepath.Base(s.lines.Source), Path: s.lines.Source}
+		}
+	}
+	return s.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+}
+
+type variablesArguments struct {
+	VariablesReference int `json:"variablesReference"`
+}
+
+func (s *Server) variables(req *request) error {
+	var args variablesArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.fail(req, err)
+	}
+	vars := []variable{}
+	s.cpu.Exclusive(func() {
+		c := s.cpu
+		switch args.VariablesReference {
+		case registersRef:
+			for i, v := range c.V {
+				vars = append(vars, variable{Name: fmt.Sprintf("V%X", i), Value: fmt.Sprintf("0x%02X", v), Type: "uint8"})
+			}
+			vars = append(vars,
+				variable{Name: "I", Value: fmt.Sprintf("0x%04X", c.I), Type: "uint16", MemoryReference: fmt.Sprintf("0x%04X", c.I)},
+				variable{Name: "PC", Value: fmt.Sprintf("0x%04X", c.PC), Type: "uint16", MemoryReference: fmt.Sprintf("0x%04X", c.PC)},
+				variable{Name: "SP", Value: strconv.Itoa(int(c.SP)), Type: "uint8"},
+			)
+		case stackRef:
+			for i := int(c.SP) - 1; i >= 0 && i < len(c.Stack); i-- {
+				value := fmt.Sprintf("0x%04X", c.Stack[i])
+				if name := s.symbolize(c.Stack[i]); name != "" {
+					value += " <" + name + ">"
+				}
+				vars = append(vars, variable{Name: fmt.Sprintf("[%d]", i), Value: value, Type: "uint16"})
+			}
+		case timersRef:
+			vars = append(vars,
+				variable{Name: "DT", Value: strconv.Itoa(int(c.DT)), Type: "uint8"},
+				variable{Name: "ST", Value: strconv.Itoa(int(c.ST)), Type: "uint8"},
+			)
+		}
+	})
+	return s.respond(req, map[string]interface{}{"variables": vars})
+}
+
+type evaluateArguments struct {
+	Expression string `json:"expression"`
+}
+
+// evaluate evaluates the name of a register or of a symbol, e.g. when hovering it in the source.
+func (s *Server) evaluate(req *request) error {
+	var args evaluateArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.fail(req, err)
+	}
+	name := strings.ToLower(strings.TrimSpace(args.Expression))
+	if addr, ok := s.symbols[args.Expression]; ok {
+		ref := fmt.Sprintf("0x%04X", addr)
+		return s.respond(req, map[string]interface{}{"result": ref, "variablesReference": 0, "memoryReference": ref})
+	}
+
+	var result string
+	s.cpu.Exclusive(func() {
+		c := s.cpu
+		if len(name) == 2 && name[0] == 'v' {
+			if x, err := strconv.ParseUint(name[1:], 16, 8); err == nil {
+				result = fmt.Sprintf("0x%02X", c.V[x])
+			}
+			return
+		}
+		switch name {
+		case "i":
+			result = fmt.Sprintf("0x%04X", c.I)
+		case "pc":
+			result = fmt.Sprintf("0x%04X", c.PC)
+		case "sp":
+			result = strconv.Itoa(int(c.SP))
+		case "dt", "delay":
+			result = strconv.Itoa(int(c.DT))
+		case "st", "buzzer":
+			result = strconv.Itoa(int(c.ST))
+		}
+	})
+	if result == "" {
+		return s.fail(req, fmt.Errorf("cannot evaluate %q", args.Expression))
+	}
+	return s.respond(req, map[string]interface{}{"result": result, "variablesReference": 0})
+}
+
+type readMemoryArguments struct {
+	MemoryReference string `json:"memoryReference"`
+	Offset          int    `json:"offset"`
+	Count           int    `json:"count"`
+}
+
+func (s *Server) readMemory(req *request) error {
+	var args readMemoryArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.fail(req, err)
+	}
+	base, err := strconv.ParseUint(args.MemoryReference, 0, 32)
+	if err != nil {
+		return s.fail(req, fmt.Errorf("invalid memory reference %q", args.MemoryReference))
+	}
+	if args.Count < 0 || args.Count > maxCount {
+		return s.fail(req, fmt.Errorf("count %d out of range [0, %d]", args.Count, maxCount))
+	}
+	addr := int(base) + args.Offset
+	var data []byte
+	s.cpu.Exclusive(func() {
+		mem := s.cpu.Memory
+		if addr >= 0 && addr < len(mem) {
+			end := addr + args.Count
+			if end > len(mem) {
+				end = len(mem)
+			}
+			data = append(data, mem[addr:end]...)
+		}
+	})
+	return s.respond(req, map[string]interface{}{
+		"address":         fmt.Sprintf("0x%04X", addr),
+		"data":            base64.StdEncoding.EncodeToString(data),
+		"unreadableBytes": args.Count - len(data),
+	})
+}
+
+// maxCount is the largest number of bytes or instructions readMemory and disassemble return, as many as
+// there are bytes in the XO-CHIP address space.
+const maxCount = 0x10000
+
+type disassembleArguments struct {
+	MemoryReference   string `json:"memoryReference"`
+	Offset            int    `json:"offset"`
+	InstructionOffset int    `json:"instructionOffset"`
+	InstructionCount  int    `json:"instructionCount"`
+}
+
+func (s *Server) disassemble(req *request) error {
+	var args disassembleArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.fail(req, err)
+	}
+	base, err := strconv.ParseUint(args.MemoryReference, 0, 32)
+	if err != nil {
+		return s.fail(req, fmt.Errorf("invalid memory reference %q", args.MemoryReference))
+	}
+	if args.InstructionCount < 0 || args.InstructionCount > maxCount {
+		return s.fail(req, fmt.Errorf("instruction count %d out of range [0, %d]", args.InstructionCount, maxCount))
+	}
+	// The instructions cannot be decoded backwards, so those before the reference are assumed to be
+	// 2 bytes long.
+	addr := int(base) + args.Offset + 2*args.InstructionOffset
+
+	instructions := make([]disassembledInstruction, 0, args.InstructionCount)
+	s.cpu.Exclusive(func() {
+		mem := s.cpu.Memory
+		for i := 0; i < args.InstructionCount; i++ {
+			in := disassembledInstruction{Address: fmt.Sprintf("0x%04X", addr&0xFFFF)}
+			size := 2
+			switch {
+			case addr < 0 || addr >= len(mem):
+				in.Instruction = "??"
+			default:
+				if decoded, ok := disasm.Decode(mem, 0, uint16(addr)); ok {
+					in.Instruction = decoded.String()
+					size = decoded.Size()
+				} else {
+					in.Instruction = fmt.Sprintf("DB #%02X", mem[addr])
+					size = 1
+				}
+				end := addr + size
+				if end > len(mem) {
+					end = len(mem)
+				}
+				in.InstructionBytes = fmt.Sprintf("%X", mem[addr:end])
+				if name, ok := s.symbolAt(uint16(addr)); ok {
+					in.Symbol = name
+				}
+				if line, ok := s.line(uint16(addr)); ok {
+					in.Line = line
+					in.Location = &source{Name: filepath.Base(s.lines.Source), Path: s.lines.Source}
+				}
+			}
+			instructions = append(instructions, in)
+			addr += size
+		}
+	})
+	return s.respond(req, map[string]interface{}{"instructions": instructions})
+}
+
+// symbolAt returns the name of the symbol at addr.
+func (s *Server) symbolAt(addr uint16) (string, bool) {
+	name, offset, ok := s.symbols.Nearest(addr)
+	return name, ok && offset == 0
+}
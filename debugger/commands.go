@@ -0,0 +1,441 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/asm"
+	"github.com/imrenagi/chip8/opcode"
+)
+
+const prompt = "(chip8) "
+
+// errQuit is returned by Execute for the quit command.
+var errQuit = errors.New("quit")
+
+const help = `break ADDR [if COND]   stop before the instruction at ADDR, optionally only when COND holds
+break if COND          stop as soon as COND holds, e.g. "break if v3 == 0x10"
+watch ADDR [SIZE]      stop after an instruction writes between ADDR and ADDR+SIZE
+rwatch ADDR [SIZE]     stop after an instruction reads between ADDR and ADDR+SIZE
+awatch ADDR [SIZE]     stop after an instruction reads or writes between ADDR and ADDR+SIZE
+info                   list the breakpoints and the watchpoints
+delete [ID]            delete a breakpoint or a watchpoint, or all of them
+continue, c            continue the execution
+pause                  stop the execution
+step, s [N]            execute N instructions
+next, n                execute an instruction, running called subroutines until they return
+finish                 run until the current subroutine returns
+regs, r                show the registers and the timers
+stack                  show the stack
+x [ADDR] [SIZE]        dump the memory, from I by default
+list, l [ADDR] [N]     disassemble N instructions, around PC by default
+symbols FILE           load a symbol map written by the assembler
+quit, q                quit the emulator
+An empty line repeats the last command. Addresses are numbers or symbols.
+`
+
+// Run reads the commands from in until it is closed or the quit command is entered.
+func (d *Debugger) Run(in io.Reader) error {
+	d.cpu.Exclusive(func() {
+		d.printf("%s\n", d.location(d.cpu.PC))
+	})
+	d.printf(prompt)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		err := d.Execute(scanner.Text())
+		if errors.Is(err, errQuit) {
+			return nil
+		}
+		if err != nil {
+			d.printf("error: %s\n", err)
+		}
+		d.printf(prompt)
+	}
+	return scanner.Err()
+}
+
+// Execute executes a command line.
+func (d *Debugger) Execute(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		fields = strings.Fields(d.last)
+		if len(fields) == 0 {
+			return nil
+		}
+	}
+	d.last = strings.Join(fields, " ")
+	args := fields[1:]
+
+	switch fields[0] {
+	case "help", "h":
+		d.printf(help)
+	case "break", "b":
+		return d.breakCommand(args)
+	case "watch":
+		return d.watchCommand(args, false, true)
+	case "rwatch":
+		return d.watchCommand(args, true, false)
+	case "awatch":
+		return d.watchCommand(args, true, true)
+	case "info", "i":
+		d.list()
+	case "delete", "d":
+		id := 0
+		if len(args) > 0 {
+			var err error
+			if id, err = strconv.Atoi(args[0]); err != nil {
+				return fmt.Errorf("invalid id %q", args[0])
+			}
+		}
+		if !d.remove(id) {
+			return fmt.Errorf("no breakpoint or watchpoint %d", id)
+		}
+	case "continue", "c":
+		d.resume(nil)
+	case "pause":
+		d.pause()
+	case "step", "s":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = parseNumber(args[0], 1<<20); err != nil {
+				return err
+			}
+		}
+		return d.step(n)
+	case "next", "n":
+		return d.next()
+	case "finish":
+		return d.finish()
+	case "regs", "r":
+		d.cpu.Exclusive(d.registers)
+	case "stack":
+		d.cpu.Exclusive(d.stack)
+	case "x":
+		return d.dump(args)
+	case "list", "l":
+		return d.disassemble(args)
+	case "symbols":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: symbols FILE")
+		}
+		return d.loadSymbols(args[0])
+	case "quit", "q":
+		return errQuit
+	default:
+		return fmt.Errorf("unknown command %q, try help", fields[0])
+	}
+	return nil
+}
+
+func (d *Debugger) breakCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: break ADDR [if COND] or break if COND")
+	}
+	b := &breakpoint{}
+	if args[0] == "if" {
+		b.anywhere = true
+	} else {
+		addr, err := d.resolve(args[0])
+		if err != nil {
+			return err
+		}
+		b.addr = addr
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		if args[0] != "if" {
+			return fmt.Errorf("expected if, found %q", args[0])
+		}
+		cond, err := parseCondition(args[1:])
+		if err != nil {
+			return err
+		}
+		b.cond = cond
+	} else if b.anywhere {
+		return fmt.Errorf("expected a condition")
+	}
+	if b.anywhere {
+		// The breakpoint stops when the condition starts to hold, not right away when it already does.
+		d.cpu.Exclusive(func() {
+			b.held = b.cond.eval(d.cpu)
+		})
+	}
+
+	d.mu.Lock()
+	b.id = d.nextID
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, b)
+	d.mu.Unlock()
+	d.printf("breakpoint %d\n", b.id)
+	return nil
+}
+
+func (d *Debugger) watchCommand(args []string, read, write bool) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: watch ADDR [SIZE]")
+	}
+	addr, err := d.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	size := 1
+	if len(args) > 1 {
+		if size, err = parseNumber(args[1], 0x10000); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	w := &watchpoint{id: d.nextID, addr: addr, size: size, read: read, write: write}
+	d.nextID++
+	d.watchpoints = append(d.watchpoints, w)
+	d.mu.Unlock()
+	d.printf("watchpoint %d\n", w.id)
+	return nil
+}
+
+// resume continues the execution from where it stopped, until the instruction for which until returns
+// true, or a breakpoint.
+func (d *Debugger) resume(until func() bool) {
+	d.mu.Lock()
+	d.resumption.Resume()
+	d.until = until
+	d.mu.Unlock()
+	d.cpu.Resume()
+}
+
+func (d *Debugger) pause() {
+	if d.cpu.Paused() {
+		d.cpu.Exclusive(func() {
+			d.printf("%s\n", d.location(d.cpu.PC))
+		})
+		return
+	}
+	d.mu.Lock()
+	d.interrupt = true
+	d.mu.Unlock()
+}
+
+func (d *Debugger) checkPaused() error {
+	if !d.cpu.Paused() {
+		return fmt.Errorf("the program is running, pause it first")
+	}
+	if d.cpu.Halted() {
+		return fmt.Errorf("the program has halted")
+	}
+	return nil
+}
+
+func (d *Debugger) step(n int) error {
+	if err := d.checkPaused(); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.resumption.Resume()
+	d.mu.Unlock()
+	for i := 0; i < n; i++ {
+		err := d.cpu.Step()
+		if errors.Is(err, chip8.ErrBreak) {
+			// The reason was reported by the hook.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	d.cpu.Exclusive(func() {
+		d.printf("%s\n", d.location(d.cpu.PC))
+	})
+	return nil
+}
+
+// next steps over the subroutine called by the instruction at PC.
+func (d *Debugger) next() error {
+	if err := d.checkPaused(); err != nil {
+		return err
+	}
+	var isCall bool
+	var ret uint16
+	var sp uint8
+	d.cpu.Exclusive(func() {
+		in, ok := d.decode(d.cpu.PC)
+		isCall = ok && in.Op == opcode.CALL
+		ret, sp = d.cpu.PC+2, d.cpu.SP
+	})
+	if !isCall {
+		return d.step(1)
+	}
+	d.resume(func() bool {
+		return d.cpu.PC == ret && d.cpu.SP == sp
+	})
+	return nil
+}
+
+// finish runs until the current subroutine returns.
+func (d *Debugger) finish() error {
+	if err := d.checkPaused(); err != nil {
+		return err
+	}
+	var sp uint8
+	d.cpu.Exclusive(func() {
+		sp = d.cpu.SP
+	})
+	if sp == 0 {
+		return fmt.Errorf("not in a subroutine")
+	}
+	d.resume(func() bool {
+		return d.cpu.SP < sp
+	})
+	return nil
+}
+
+func (d *Debugger) decode(addr uint16) (opcode.Instruction, bool) {
+	if int(addr)+1 >= len(d.cpu.Memory) {
+		return opcode.Instruction{}, false
+	}
+	in := opcode.Decode(uint16(d.cpu.Memory[addr])<<8 | uint16(d.cpu.Memory[addr+1]))
+	return in, in.Op != opcode.Invalid
+}
+
+// registers writes the registers and the timers. It is called while the CPU is locked.
+func (d *Debugger) registers() {
+	c := d.cpu
+	var b strings.Builder
+	for i, v := range c.V {
+		fmt.Fprintf(&b, "V%X %02X", i, v)
+		if i%8 == 7 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString("  ")
+		}
+	}
+	d.mu.Lock()
+	pc := d.symbolize(c.PC)
+	i := d.symbolize(c.I)
+	d.mu.Unlock()
+	fmt.Fprintf(&b, "PC %04X%s\n", c.PC, pc)
+	fmt.Fprintf(&b, "I  %04X%s\n", c.I, i)
+	fmt.Fprintf(&b, "SP %X  DT %02X  ST %02X\n", c.SP, c.DT, c.ST)
+	d.printf("%s", b.String())
+}
+
+// stack writes the return addresses on the stack, the topmost first. It is called while the CPU is locked.
+func (d *Debugger) stack() {
+	c := d.cpu
+	if c.SP == 0 {
+		d.printf("the stack is empty\n")
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := int(c.SP) - 1; i >= 0 && i < len(c.Stack); i-- {
+		d.printf("#%-2d 0x%04X%s\n", i, c.Stack[i], d.symbolize(c.Stack[i]))
+	}
+}
+
+// dump writes a hexdump of the memory.
+func (d *Debugger) dump(args []string) error {
+	var addr uint16
+	hasAddr := len(args) > 0
+	if hasAddr {
+		var err error
+		if addr, err = d.resolve(args[0]); err != nil {
+			return err
+		}
+	}
+	size := 64
+	if len(args) > 1 {
+		var err error
+		if size, err = parseNumber(args[1], 0x10000); err != nil {
+			return err
+		}
+	}
+
+	d.cpu.Exclusive(func() {
+		mem := d.cpu.Memory
+		if !hasAddr {
+			addr = d.cpu.I
+		}
+		var b strings.Builder
+		for row := int(addr); row < int(addr)+size && row < len(mem); row += 16 {
+			fmt.Fprintf(&b, "%04X ", row)
+			for i := row; i < row+16 && i < int(addr)+size && i < len(mem); i++ {
+				fmt.Fprintf(&b, " %02X", mem[i])
+			}
+			b.WriteString("\n")
+		}
+		d.printf("%s", b.String())
+	})
+	return nil
+}
+
+// disassemble lists n instructions starting at an address, or around PC.
+func (d *Debugger) disassemble(args []string) error {
+	var addr uint16
+	hasAddr := len(args) > 0
+	if hasAddr {
+		var err error
+		if addr, err = d.resolve(args[0]); err != nil {
+			return err
+		}
+	}
+	n := 10
+	if len(args) > 1 {
+		var err error
+		if n, err = parseNumber(args[1], 0x8000); err != nil {
+			return err
+		}
+	}
+
+	d.cpu.Exclusive(func() {
+		pc := d.cpu.PC
+		if !hasAddr {
+			// The instructions cannot be decoded backwards, so a few are assumed to be 2 bytes long.
+			addr = pc
+			for i := 0; i < 3 && addr >= 2; i++ {
+				addr -= 2
+			}
+		}
+		for i := 0; i < n && int(addr) < len(d.cpu.Memory); i++ {
+			d.mu.Lock()
+			for name, a := range d.symbols {
+				if a == addr {
+					d.printf("%s:\n", name)
+				}
+			}
+			d.mu.Unlock()
+			marker := "  "
+			if addr == pc {
+				marker = "=>"
+			}
+			d.printf("%s %04X  %s\n", marker, addr, d.instruction(addr))
+			if in, ok := d.decode(addr); ok {
+				addr += uint16(in.Op.Size())
+			} else {
+				addr++
+			}
+		}
+	})
+	return nil
+}
+
+func (d *Debugger) loadSymbols(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	symbols, err := asm.ReadSymbols(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	d.SetSymbols(symbols)
+	d.printf("%d symbols loaded\n", len(symbols))
+	return nil
+}
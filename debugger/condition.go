@@ -0,0 +1,98 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/imrenagi/chip8"
+)
+
+// condition compares a register with a value, e.g. "v3 == 0x10".
+type condition struct {
+	reg string
+	op  string
+	val int
+}
+
+var operators = map[string]func(a, b int) bool{
+	"==": func(a, b int) bool { return a == b },
+	"!=": func(a, b int) bool { return a != b },
+	"<":  func(a, b int) bool { return a < b },
+	"<=": func(a, b int) bool { return a <= b },
+	">":  func(a, b int) bool { return a > b },
+	">=": func(a, b int) bool { return a >= b },
+}
+
+// parseCondition parses "REG OP VALUE", where REG is v0 to vf, i, pc, sp, dt or st.
+func parseCondition(args []string) (*condition, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("expected a condition such as \"v3 == 0x10\"")
+	}
+	reg := strings.ToLower(args[0])
+	if _, ok := register(nil, reg); !ok {
+		return nil, fmt.Errorf("unknown register %q", args[0])
+	}
+	if _, ok := operators[args[1]]; !ok {
+		return nil, fmt.Errorf("unknown comparison %q", args[1])
+	}
+	val, err := parseNumber(args[2], 0xFFFF)
+	if err != nil {
+		return nil, err
+	}
+	return &condition{reg: reg, op: args[1], val: val}, nil
+}
+
+func (c *condition) eval(cpu *chip8.CPU) bool {
+	v, _ := register(cpu, c.reg)
+	return operators[c.op](v, c.val)
+}
+
+func (c *condition) String() string {
+	return fmt.Sprintf("%s %s 0x%X", c.reg, c.op, c.val)
+}
+
+// register returns the value of the register named name. cpu may be nil to only check the name.
+func register(cpu *chip8.CPU, name string) (int, bool) {
+	if len(name) == 2 && name[0] == 'v' {
+		x, err := strconv.ParseUint(name[1:], 16, 8)
+		if err != nil {
+			return 0, false
+		}
+		if cpu == nil {
+			return 0, true
+		}
+		return int(cpu.V[x]), true
+	}
+	var v int
+	switch name {
+	case "i", "pc", "sp", "dt", "st":
+	default:
+		return 0, false
+	}
+	if cpu == nil {
+		return 0, true
+	}
+	switch name {
+	case "i":
+		v = int(cpu.I)
+	case "pc":
+		v = int(cpu.PC)
+	case "sp":
+		v = int(cpu.SP)
+	case "dt":
+		v = int(cpu.DT)
+	case "st":
+		v = int(cpu.ST)
+	}
+	return v, true
+}
+
+// parseNumber parses a decimal, 0x hexadecimal or 0b binary number between 0 and max.
+func parseNumber(text string, max int) (int, error) {
+	v, err := strconv.ParseUint(text, 0, 32)
+	if err != nil || int(v) > max {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+	return int(v), nil
+}
@@ -0,0 +1,301 @@
+// Package debugger implements an interactive debugger for the CHIP-8 CPU.
+//
+// The debugger follows the execution through the CPU hooks and stops it at breakpoints and watchpoints
+// by making Start pause. It is driven with text commands, typically read from the terminal by Run
+// while the emulator keeps its window open.
+package debugger
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/asm"
+	"github.com/imrenagi/chip8/disasm"
+)
+
+// breakpoint stops the execution before the instruction at addr, or before any instruction when anywhere
+// is set, provided cond holds.
+type breakpoint struct {
+	id       int
+	addr     uint16
+	anywhere bool
+	cond     *condition
+	// held is whether cond held at the previous instruction. A breakpoint set anywhere only stops when
+	// its condition starts to hold, rather than before every instruction while it does.
+	held bool
+}
+
+// watchpoint stops the execution after an instruction reading or writing a byte between addr and
+// addr+size.
+type watchpoint struct {
+	id          int
+	addr        uint16
+	size        int
+	read, write bool
+}
+
+func (w *watchpoint) contains(addr int) bool {
+	return addr >= int(w.addr) && addr < int(w.addr)+w.size
+}
+
+func (w *watchpoint) kind() string {
+	switch {
+	case w.read && w.write:
+		return "access"
+	case w.read:
+		return "read"
+	}
+	return "write"
+}
+
+// Debugger controls the execution of a CPU. It must be created before the CPU starts, since it sets
+// the hooks of the CPU.
+type Debugger struct {
+	cpu *chip8.CPU
+
+	outMu sync.Mutex
+	out   io.Writer
+
+	mu          sync.Mutex
+	symbols     asm.Symbols
+	breakpoints []*breakpoint
+	watchpoints []*watchpoint
+	nextID      int
+	resumption  chip8.Resumption
+	// interrupt stops the execution before the next instruction.
+	interrupt bool
+	// until stops the execution after the instruction for which it returns true. It implements stepping
+	// over and out of subroutines.
+	until func() bool
+	// hit describes the watchpoint triggered by the instruction being executed.
+	hit string
+
+	// last is the last command, repeated by an empty line.
+	last string
+}
+
+// New returns a Debugger controlling cpu, which writes its output to out.
+func New(cpu *chip8.CPU, out io.Writer) *Debugger {
+	d := &Debugger{
+		cpu:     cpu,
+		out:     out,
+		symbols: asm.Symbols{},
+		nextID:  1,
+	}
+	cpu.Hooks.BeforeStep = d.beforeStep
+	cpu.Hooks.AfterStep = d.afterStep
+	cpu.Hooks.MemoryRead = d.memoryRead
+	cpu.Hooks.MemoryWrite = d.memoryWrite
+	return d
+}
+
+// SetSymbols sets the names of the addresses, as read from a symbol map, which are shown in the listings
+// and can be used instead of the addresses in the commands.
+func (d *Debugger) SetSymbols(symbols asm.Symbols) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.symbols = symbols
+}
+
+func (d *Debugger) printf(format string, args ...interface{}) {
+	d.outMu.Lock()
+	defer d.outMu.Unlock()
+	fmt.Fprintf(d.out, format, args...)
+}
+
+// stop reports why the execution stopped. It is called while the CPU is locked.
+func (d *Debugger) stop(reason string) error {
+	d.printf("\n%s\n%s\n%s", reason, d.location(d.cpu.PC), prompt)
+	return chip8.ErrBreak
+}
+
+func (d *Debugger) beforeStep() error {
+	d.mu.Lock()
+	if d.interrupt {
+		d.interrupt = false
+		d.mu.Unlock()
+		return d.stop("interrupted")
+	}
+	resuming := d.resumption.Skip()
+	var hit *breakpoint
+	for _, b := range d.breakpoints {
+		if !b.anywhere && b.addr != d.cpu.PC {
+			continue
+		}
+		held := b.cond == nil || b.cond.eval(d.cpu)
+		if b.anywhere {
+			held, b.held = held && !b.held, held
+		}
+		if held && hit == nil && !resuming {
+			hit = b
+		}
+	}
+	d.mu.Unlock()
+
+	if hit != nil {
+		reason := fmt.Sprintf("breakpoint %d", hit.id)
+		if hit.cond != nil {
+			reason += fmt.Sprintf(", %s", hit.cond)
+		}
+		return d.stop(reason)
+	}
+	return nil
+}
+
+func (d *Debugger) afterStep() error {
+	d.mu.Lock()
+	hit := d.hit
+	d.hit = ""
+	done := d.until != nil && d.until()
+	if done {
+		d.until = nil
+	}
+	d.mu.Unlock()
+
+	if hit != "" {
+		return d.stop(hit)
+	}
+	if done {
+		return d.stop("stepped")
+	}
+	return nil
+}
+
+func (d *Debugger) memoryRead(addr int, val uint8) {
+	d.memoryAccess(addr, val, false)
+}
+
+func (d *Debugger) memoryWrite(addr int, val uint8) {
+	d.memoryAccess(addr, val, true)
+}
+
+func (d *Debugger) memoryAccess(addr int, val uint8, write bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.hit != "" {
+		return
+	}
+	for _, w := range d.watchpoints {
+		if !w.contains(addr) || (write && !w.write) || (!write && !w.read) {
+			continue
+		}
+		access := "read"
+		if write {
+			access = "write"
+		}
+		d.hit = fmt.Sprintf("watchpoint %d, %s of 0x%02X at 0x%04X%s", w.id, access, val, addr, d.symbolize(uint16(addr)))
+		return
+	}
+}
+
+// symbolize returns " <name+offset>" for the closest symbol at or before addr, or "" when there is none.
+// d.mu must be held.
+func (d *Debugger) symbolize(addr uint16) string {
+	name, offset, ok := d.symbols.Nearest(addr)
+	if !ok {
+		return ""
+	}
+	if offset == 0 {
+		return fmt.Sprintf(" <%s>", name)
+	}
+	return fmt.Sprintf(" <%s+%d>", name, offset)
+}
+
+// location describes the instruction at addr. It is called while the CPU is locked.
+func (d *Debugger) location(addr uint16) string {
+	d.mu.Lock()
+	sym := d.symbolize(addr)
+	d.mu.Unlock()
+	return fmt.Sprintf("0x%04X%s: %s", addr, sym, d.instruction(addr))
+}
+
+// instruction returns the opcode and the mnemonic of the instruction at addr.
+func (d *Debugger) instruction(addr uint16) string {
+	in, ok := disasm.Decode(d.cpu.Memory, 0, addr)
+	if !ok {
+		if int(addr) < len(d.cpu.Memory) {
+			return fmt.Sprintf("%02X         DB #%02X", d.cpu.Memory[addr], d.cpu.Memory[addr])
+		}
+		return "??"
+	}
+	code := fmt.Sprintf("%04X", in.Opcode)
+	if in.Size() == 4 {
+		code += fmt.Sprintf(" %04X", in.Long)
+	}
+	return fmt.Sprintf("%-9s  %s", code, in)
+}
+
+// resolve returns the address named by text: a symbol or a number.
+func (d *Debugger) resolve(text string) (uint16, error) {
+	d.mu.Lock()
+	addr, ok := d.symbols[text]
+	d.mu.Unlock()
+	if ok {
+		return addr, nil
+	}
+	v, err := parseNumber(text, 0xFFFF)
+	if err != nil {
+		return 0, fmt.Errorf("unknown address %q", text)
+	}
+	return uint16(v), nil
+}
+
+// list writes the breakpoints and the watchpoints.
+func (d *Debugger) list() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.breakpoints) == 0 && len(d.watchpoints) == 0 {
+		d.printf("no breakpoints or watchpoints\n")
+		return
+	}
+	type entry struct {
+		id   int
+		line string
+	}
+	var entries []entry
+	for _, b := range d.breakpoints {
+		where := "anywhere"
+		if !b.anywhere {
+			where = fmt.Sprintf("0x%04X%s", b.addr, d.symbolize(b.addr))
+		}
+		line := fmt.Sprintf("breakpoint  %s", where)
+		if b.cond != nil {
+			line += fmt.Sprintf(" if %s", b.cond)
+		}
+		entries = append(entries, entry{b.id, line})
+	}
+	for _, w := range d.watchpoints {
+		line := fmt.Sprintf("watchpoint  %s 0x%04X%s, %d bytes", w.kind(), w.addr, d.symbolize(w.addr), w.size)
+		entries = append(entries, entry{w.id, line})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+	for _, e := range entries {
+		d.printf("%d\t%s\n", e.id, e.line)
+	}
+}
+
+// remove deletes the breakpoint or watchpoint id, or all of them when id is 0.
+func (d *Debugger) remove(id int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if id == 0 {
+		d.breakpoints, d.watchpoints = nil, nil
+		return true
+	}
+	for i, b := range d.breakpoints {
+		if b.id == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	for i, w := range d.watchpoints {
+		if w.id == id {
+			d.watchpoints = append(d.watchpoints[:i], d.watchpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+// Package disasm disassembles CHIP-8, SUPER-CHIP and XO-CHIP programs.
+//
+// The code is told apart from the data by following the flow of the program from its entry point:
+// the jumps, the calls and both outcomes of the skips. Whatever is never reached is listed as data.
+package disasm
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/imrenagi/chip8/opcode"
+)
+
+// Instruction is an instruction decoded at an address of the program.
+type Instruction struct {
+	Addr   uint16
+	Opcode uint16
+	// Long is the address following the F000 nnnn instruction.
+	Long uint16
+	opcode.Instruction
+}
+
+// Size returns the length of the instruction in bytes.
+func (in Instruction) Size() int {
+	return in.Op.Size()
+}
+
+// Target returns the address the instruction refers to, if any: the destination of a jump or a call,
+// or the address loaded into I.
+func (in Instruction) Target() (uint16, bool) {
+	switch in.Op {
+	case opcode.JP, opcode.CALL, opcode.JPV0, opcode.LDI:
+		return in.NNN, true
+	case opcode.LDILong:
+		return in.Long, true
+	}
+	return 0, false
+}
+
+// Decode decodes the instruction at addr of a program loaded at origin.
+// It returns false when addr is outside of the program or does not hold an instruction.
+func Decode(program []byte, origin, addr uint16) (Instruction, bool) {
+	off := int(addr) - int(origin)
+	if off < 0 || off+1 >= len(program) {
+		return Instruction{}, false
+	}
+	code := uint16(program[off])<<8 | uint16(program[off+1])
+	in := Instruction{Addr: addr, Opcode: code, Instruction: opcode.Decode(code)}
+	if in.Op == opcode.Invalid {
+		return Instruction{}, false
+	}
+	if in.Op == opcode.LDILong {
+		if off+3 >= len(program) {
+			return Instruction{}, false
+		}
+		in.Long = uint16(program[off+2])<<8 | uint16(program[off+3])
+	}
+	return in, true
+}
+
+// Program is a disassembled program.
+type Program struct {
+	Origin uint16
+	Bytes  []byte
+
+	// Code holds the instructions reached from the entry point, by address.
+	Code map[uint16]Instruction
+	// Labels holds the names given to the addresses referred to by the instructions.
+	Labels map[uint16]string
+}
+
+// Disassemble disassembles a program loaded at origin, starting from its first byte.
+func Disassemble(program []byte, origin uint16) *Program {
+	p := &Program{
+		Origin: origin,
+		Bytes:  program,
+		Code:   map[uint16]Instruction{},
+		Labels: map[uint16]string{},
+	}
+
+	pending := []uint16{origin}
+	for len(pending) > 0 {
+		addr := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for {
+			if _, seen := p.Code[addr]; seen {
+				break
+			}
+			in, ok := Decode(program, origin, addr)
+			if !ok {
+				break
+			}
+			p.Code[addr] = in
+			next := addr + uint16(in.Size())
+
+			if target, ok := in.Target(); ok && p.contains(target) {
+				p.label(in.Op, target)
+			}
+
+			stop := false
+			switch in.Op {
+			case opcode.JP:
+				pending = append(pending, in.NNN)
+				stop = true
+			case opcode.CALL:
+				pending = append(pending, in.NNN)
+			case opcode.JPV0:
+				// The destination depends on V0. It usually is a table of jumps, so it is
+				// followed as code from its start.
+				pending = append(pending, in.NNN)
+				stop = true
+			case opcode.RET, opcode.EXIT:
+				stop = true
+			}
+			if in.Op.IsSkip() {
+				if skipped, ok := Decode(program, origin, next); ok {
+					pending = append(pending, next+uint16(skipped.Size()))
+				}
+			}
+			if stop {
+				break
+			}
+			addr = next
+		}
+	}
+	// The entry point is named main, as Octo expects.
+	if len(program) > 0 {
+		p.Labels[origin] = "main"
+	}
+	return p
+}
+
+func (p *Program) contains(addr uint16) bool {
+	return addr >= p.Origin && int(addr)-int(p.Origin) < len(p.Bytes)
+}
+
+func (p *Program) label(op opcode.Op, addr uint16) {
+	prefix := "label"
+	switch op {
+	case opcode.CALL:
+		prefix = "sub"
+	case opcode.LDI, opcode.LDILong:
+		prefix = "data"
+	}
+	// A subroutine keeps its name even when it is also jumped to.
+	if name, ok := p.Labels[addr]; ok && (name[:3] == "sub" || prefix == "data") {
+		return
+	}
+	p.Labels[addr] = fmt.Sprintf("%s_%03X", prefix, addr)
+}
+
+// Addresses returns the addresses of the instructions, in order.
+func (p *Program) Addresses() []uint16 {
+	addrs := make([]uint16, 0, len(p.Code))
+	for addr := range p.Code {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
@@ -0,0 +1,66 @@
+package disasm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/imrenagi/chip8/asm"
+)
+
+// roundTripSource mixes code, data reached through I and every kind of jump.
+const roundTripSource = `
+: digit
+	0xF0 0x90 0x90 0x90 0xF0
+
+: draw
+	i := digit
+	sprite v0 v1 5
+	return
+
+: main
+	hires
+	v0 := 0
+	v1 := 0
+	loop
+		draw
+		v0 += 8
+		if v0 == 64 begin
+			v0 := 0
+			v1 += 6
+		else
+			v2 := random 0xFF
+		end
+		if v1 != 30 then
+	again
+	i := long tune
+	audio
+	pitch := v2
+	v3 := key
+	jump0 table
+
+: table
+	exit
+	scroll-down 4
+
+: tune
+	0x0F 0xF0 0x0F 0xF0
+`
+
+func TestListingRoundTrip(t *testing.T) {
+	src, err := asm.Assemble("round-trip.8o", []byte(roundTripSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var listing bytes.Buffer
+	if err := Disassemble(src.Bytes, asm.Origin).WriteListing(&listing, Octo); err != nil {
+		t.Fatal(err)
+	}
+	got, err := asm.Assemble("listing.8o", listing.Bytes())
+	if err != nil {
+		t.Fatalf("%v in the listing:\n%s", err, listing.String())
+	}
+	if !bytes.Equal(got.Bytes, src.Bytes) {
+		t.Errorf("listing assembles to\n% X\nwant\n% X\nlisting:\n%s", got.Bytes, src.Bytes, listing.String())
+	}
+}
@@ -0,0 +1,318 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/imrenagi/chip8/opcode"
+)
+
+// Style selects the syntax of a listing.
+type Style int
+
+const (
+	// Octo lists the program in the syntax of the Octo assembler, so that it can be assembled again.
+	Octo Style = iota
+	// Cowgod lists the address, the opcode and the mnemonic of every instruction, in the notation of
+	// Cowgod's Chip-8 Technical Reference.
+	Cowgod
+)
+
+// bytesPerDataLine is the number of data bytes listed on a line.
+const bytesPerDataLine = 8
+
+// Mnemonic returns the name of the instruction, e.g. LD.
+func (in Instruction) Mnemonic() string {
+	return in.Op.Mnemonic()
+}
+
+// Operands returns the operands of the instruction in the Cowgod notation, e.g. V0 and #12.
+func (in Instruction) Operands() []string {
+	return cowgodOperands(in, hexAddr)
+}
+
+func (in Instruction) String() string {
+	ops := in.Operands()
+	if len(ops) == 0 {
+		return in.Mnemonic()
+	}
+	return in.Mnemonic() + " " + strings.Join(ops, ", ")
+}
+
+func hexAddr(addr uint16) string {
+	return fmt.Sprintf("#%03X", addr)
+}
+
+func cowgodOperands(in Instruction, addr func(uint16) string) []string {
+	vx := fmt.Sprintf("V%X", in.X)
+	vy := fmt.Sprintf("V%X", in.Y)
+	kk := fmt.Sprintf("#%02X", in.KK)
+	switch in.Op {
+	case opcode.SCD, opcode.SCU:
+		return []string{fmt.Sprintf("%d", in.N)}
+	case opcode.JP, opcode.CALL:
+		return []string{addr(in.NNN)}
+	case opcode.SEVxByte, opcode.SNEVxByte, opcode.LDVxByte, opcode.ADDVxByte, opcode.RND:
+		return []string{vx, kk}
+	case opcode.SEVxVy, opcode.LDVxVy, opcode.OR, opcode.AND, opcode.XOR, opcode.ADDVxVy,
+		opcode.SUB, opcode.SHR, opcode.SUBN, opcode.SHL, opcode.SNEVxVy:
+		return []string{vx, vy}
+	case opcode.SaveRange:
+		return []string{"[I]", vx + "-" + vy}
+	case opcode.LoadRange:
+		return []string{vx + "-" + vy, "[I]"}
+	case opcode.LDI:
+		return []string{"I", addr(in.NNN)}
+	case opcode.JPV0:
+		return []string{"V0", addr(in.NNN)}
+	case opcode.DRW:
+		return []string{vx, vy, fmt.Sprintf("%d", in.N)}
+	case opcode.SKP, opcode.SKNP, opcode.PITCH:
+		return []string{vx}
+	case opcode.LDILong:
+		return []string{"I", addr(in.Long)}
+	case opcode.PLANE:
+		return []string{fmt.Sprintf("%d", in.X)}
+	case opcode.LDVxDT:
+		return []string{vx, "DT"}
+	case opcode.LDVxK:
+		return []string{vx, "K"}
+	case opcode.LDDTVx:
+		return []string{"DT", vx}
+	case opcode.LDSTVx:
+		return []string{"ST", vx}
+	case opcode.ADDIVx:
+		return []string{"I", vx}
+	case opcode.LDFVx:
+		return []string{"F", vx}
+	case opcode.LDHFVx:
+		return []string{"HF", vx}
+	case opcode.LDBVx:
+		return []string{"B", vx}
+	case opcode.LDIVx:
+		return []string{"[I]", vx}
+	case opcode.LDVxI:
+		return []string{vx, "[I]"}
+	case opcode.LDRVx:
+		return []string{"R", vx}
+	case opcode.LDVxR:
+		return []string{vx, "R"}
+	}
+	return nil
+}
+
+// octoStatement returns the instruction in the Octo syntax. Octo has no skip instructions, only
+// "if condition then", which skips the next statement when the condition is false, so the
+// conditions are the opposite of the skip instructions.
+func octoStatement(in Instruction, addr func(uint16) string) string {
+	vx := fmt.Sprintf("v%x", in.X)
+	vy := fmt.Sprintf("v%x", in.Y)
+	kk := fmt.Sprintf("0x%02X", in.KK)
+	switch in.Op {
+	case opcode.CLS:
+		return "clear"
+	case opcode.RET:
+		return "return"
+	case opcode.SCD:
+		return fmt.Sprintf("scroll-down %d", in.N)
+	case opcode.SCU:
+		return fmt.Sprintf("scroll-up %d", in.N)
+	case opcode.SCR:
+		return "scroll-right"
+	case opcode.SCL:
+		return "scroll-left"
+	case opcode.EXIT:
+		return "exit"
+	case opcode.LOW:
+		return "lores"
+	case opcode.HIGH:
+		return "hires"
+	case opcode.JP:
+		return "jump " + addr(in.NNN)
+	case opcode.CALL:
+		return ":call " + addr(in.NNN)
+	case opcode.SEVxByte:
+		return fmt.Sprintf("if %s != %s then", vx, kk)
+	case opcode.SNEVxByte:
+		return fmt.Sprintf("if %s == %s then", vx, kk)
+	case opcode.SEVxVy:
+		return fmt.Sprintf("if %s != %s then", vx, vy)
+	case opcode.SaveRange:
+		return fmt.Sprintf("save %s - %s", vx, vy)
+	case opcode.LoadRange:
+		return fmt.Sprintf("load %s - %s", vx, vy)
+	case opcode.LDVxByte:
+		return fmt.Sprintf("%s := %s", vx, kk)
+	case opcode.ADDVxByte:
+		return fmt.Sprintf("%s += %s", vx, kk)
+	case opcode.LDVxVy:
+		return fmt.Sprintf("%s := %s", vx, vy)
+	case opcode.OR:
+		return fmt.Sprintf("%s |= %s", vx, vy)
+	case opcode.AND:
+		return fmt.Sprintf("%s &= %s", vx, vy)
+	case opcode.XOR:
+		return fmt.Sprintf("%s ^= %s", vx, vy)
+	case opcode.ADDVxVy:
+		return fmt.Sprintf("%s += %s", vx, vy)
+	case opcode.SUB:
+		return fmt.Sprintf("%s -= %s", vx, vy)
+	case opcode.SHR:
+		return fmt.Sprintf("%s >>= %s", vx, vy)
+	case opcode.SUBN:
+		return fmt.Sprintf("%s =- %s", vx, vy)
+	case opcode.SHL:
+		return fmt.Sprintf("%s <<= %s", vx, vy)
+	case opcode.SNEVxVy:
+		return fmt.Sprintf("if %s == %s then", vx, vy)
+	case opcode.LDI:
+		return "i := " + addr(in.NNN)
+	case opcode.JPV0:
+		return "jump0 " + addr(in.NNN)
+	case opcode.RND:
+		return fmt.Sprintf("%s := random %s", vx, kk)
+	case opcode.DRW:
+		return fmt.Sprintf("sprite %s %s %d", vx, vy, in.N)
+	case opcode.SKP:
+		return fmt.Sprintf("if %s -key then", vx)
+	case opcode.SKNP:
+		return fmt.Sprintf("if %s key then", vx)
+	case opcode.LDILong:
+		return "i := long " + addr(in.Long)
+	case opcode.PLANE:
+		return fmt.Sprintf("plane %d", in.X)
+	case opcode.AUDIO:
+		return "audio"
+	case opcode.LDVxDT:
+		return vx + " := delay"
+	case opcode.LDVxK:
+		return vx + " := key"
+	case opcode.LDDTVx:
+		return "delay := " + vx
+	case opcode.LDSTVx:
+		return "buzzer := " + vx
+	case opcode.ADDIVx:
+		return "i += " + vx
+	case opcode.LDFVx:
+		return "i := hex " + vx
+	case opcode.LDHFVx:
+		return "i := bighex " + vx
+	case opcode.LDBVx:
+		return "bcd " + vx
+	case opcode.PITCH:
+		return "pitch := " + vx
+	case opcode.LDIVx:
+		return "save " + vx
+	case opcode.LDVxI:
+		return "load " + vx
+	case opcode.LDRVx:
+		return "saveflags " + vx
+	case opcode.LDVxR:
+		return "loadflags " + vx
+	}
+	return fmt.Sprintf("0x%02X 0x%02X", in.Opcode>>8, in.Opcode&0xFF)
+}
+
+// WriteListing writes the listing of the program to w in the given style.
+func (p *Program) WriteListing(w io.Writer, style Style) error {
+	bw := bufio.NewWriter(w)
+
+	if style == Octo && p.Origin != 0x200 {
+		fmt.Fprintf(bw, ":org 0x%03X\n", p.Origin)
+	}
+
+	addr := p.Origin
+	end := int(p.Origin) + len(p.Bytes)
+	for int(addr) < end {
+		if name, ok := p.Labels[addr]; ok {
+			if style == Octo {
+				fmt.Fprintf(bw, ": %s\n", name)
+			} else {
+				fmt.Fprintf(bw, "%s:\n", name)
+			}
+		}
+
+		if in, ok := p.Code[addr]; ok && !p.splitsLabel(in) {
+			p.writeInstruction(bw, in, style)
+			addr += uint16(in.Size())
+			continue
+		}
+
+		// The data runs until the next instruction or label.
+		var data []byte
+		for int(addr)+len(data) < end && len(data) < bytesPerDataLine {
+			next := addr + uint16(len(data))
+			if len(data) > 0 {
+				if _, ok := p.Labels[next]; ok {
+					break
+				}
+			}
+			if in, ok := p.Code[next]; ok && !p.splitsLabel(in) {
+				break
+			}
+			data = append(data, p.Bytes[int(next)-int(p.Origin)])
+		}
+		p.writeData(bw, addr, data, style)
+		addr += uint16(len(data))
+	}
+	return bw.Flush()
+}
+
+// splitsLabel reports whether a label points inside the instruction, in which case it is listed as data
+// so that the label can be placed.
+func (p *Program) splitsLabel(in Instruction) bool {
+	for addr := in.Addr + 1; addr < in.Addr+uint16(in.Size()); addr++ {
+		if _, ok := p.Labels[addr]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Program) name(addr uint16) string {
+	if name, ok := p.Labels[addr]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+func (p *Program) cowgodName(addr uint16) string {
+	if name, ok := p.Labels[addr]; ok {
+		return name
+	}
+	return hexAddr(addr)
+}
+
+func (p *Program) writeInstruction(w io.Writer, in Instruction, style Style) {
+	if style == Octo {
+		fmt.Fprintf(w, "\t%s\n", octoStatement(in, p.name))
+		return
+	}
+	code := fmt.Sprintf("%04X", in.Opcode)
+	if in.Op == opcode.LDILong {
+		code += fmt.Sprintf(" %04X", in.Long)
+	}
+	text := in.Mnemonic()
+	if ops := cowgodOperands(in, p.cowgodName); len(ops) > 0 {
+		text += " " + strings.Join(ops, ", ")
+	}
+	fmt.Fprintf(w, "\t%04X  %-9s  %s\n", in.Addr, code, text)
+}
+
+func (p *Program) writeData(w io.Writer, addr uint16, data []byte, style Style) {
+	items := make([]string, len(data))
+	for i, b := range data {
+		if style == Octo {
+			items[i] = fmt.Sprintf("0x%02X", b)
+		} else {
+			items[i] = fmt.Sprintf("#%02X", b)
+		}
+	}
+	if style == Octo {
+		fmt.Fprintf(w, "\t%s\n", strings.Join(items, " "))
+		return
+	}
+	fmt.Fprintf(w, "\t%04X  %-9s  DB %s\n", addr, "", strings.Join(items, ", "))
+}
@@ -1,16 +1,27 @@
 package chip8
 
 import (
-	"sync"
+	"image"
+	"image/color"
+)
+
+const (
+	// displayWidth and displayHeight are the size of the SUPER-CHIP high resolution screen.
+	// Low resolution pixels are drawn as 2x2 blocks of it.
+	displayWidth  = 128
+	displayHeight = 64
 
-	"github.com/veandco/go-sdl2/sdl"
+	loresWidth  = 64
+	loresHeight = 32
 )
 
-func DefaultDisplay() Display {
+// NewDisplay returns a Display in the 64x32 mode drawn with drawer.
+func NewDisplay(drawer Drawer) Display {
 	d := Display{
-		H:      64,
-		W:      128,
-		drawer: NewSDLDisplay(),
+		H:      loresHeight,
+		W:      loresWidth,
+		planes: 0x1,
+		drawer: drawer,
 	}
 	return d
 }
@@ -18,14 +29,82 @@ func DefaultDisplay() Display {
 type Display struct {
 	drawer Drawer
 
+	// H and W are the size of the current resolution, either 64x32 or 128x64.
 	H, W uint8
-	data [8192]uint8
+
+	// data holds one byte per pixel. Each bit of it is the pixel of one XO-CHIP bitplane,
+	// so a plain CHIP-8 program only ever uses the first bit.
+	data [displayWidth * displayHeight]uint8
+
+	// planes is the bitmask of the planes affected by drawing, clearing and scrolling.
+	planes uint8
 }
 
+// SetResolution switches between the 64x32 and 128x64 modes. All planes are cleared.
+func (d *Display) SetResolution(hires bool) {
+	if hires {
+		d.W, d.H = displayWidth, displayHeight
+	} else {
+		d.W, d.H = loresWidth, loresHeight
+	}
+	d.data = [displayWidth * displayHeight]uint8{}
+	d.drawer.Clear()
+}
+
+// SelectPlanes sets the bitmask of the XO-CHIP planes the next operations work on.
+func (d *Display) SelectPlanes(mask uint8) {
+	d.planes = mask & 0x3
+}
+
+// Planes returns the bitmask of the selected planes.
+func (d *Display) Planes() uint8 {
+	return d.planes
+}
+
+// Clear clears the selected planes.
 func (d *Display) Clear() {
+	for i := range d.data {
+		d.data[i] &^= d.planes
+	}
 	d.drawer.Clear()
 }
 
+// ScrollDown moves the content of the selected planes n pixels down.
+func (d *Display) ScrollDown(n uint8) {
+	d.scroll(0, int(n))
+}
+
+// ScrollUp moves the content of the selected planes n pixels up.
+func (d *Display) ScrollUp(n uint8) {
+	d.scroll(0, -int(n))
+}
+
+// ScrollLeft moves the content of the selected planes n pixels to the left.
+func (d *Display) ScrollLeft(n uint8) {
+	d.scroll(-int(n), 0)
+}
+
+// ScrollRight moves the content of the selected planes n pixels to the right.
+func (d *Display) ScrollRight(n uint8) {
+	d.scroll(int(n), 0)
+}
+
+func (d *Display) scroll(dx, dy int) {
+	w, h := int(d.W), int(d.H)
+	src := d.data
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var val uint8
+			sx, sy := x-dx, y-dy
+			if sx >= 0 && sx < w && sy >= 0 && sy < h {
+				val = src[sy*w+sx]
+			}
+			t := y*w + x
+			d.data[t] = d.data[t]&^d.planes | val&d.planes
+		}
+	}
+}
+
 func (d *Display) SetPixel(x, y uint8, val uint8) {
 	t := uint16(y)*uint16(d.W) + uint16(x)
 	d.data[t] = val
@@ -38,67 +117,67 @@ func (d *Display) GetPixel(x, y uint8) uint8 {
 
 func (d *Display) Draw() {
 	d.drawer.Clear()
-	for i, val := range d.data {
+	scale := displayWidth / int(d.W)
+	for i, val := range d.data[:int(d.W)*int(d.H)] {
 		y := i / int(d.W) // 4 / 3 = 1
 		x := i % int(d.W) // 4 % 3 = 2
-		if val > 0 {
-			d.drawer.SetPixel(x, y)
+		if val == 0 {
+			continue
+		}
+		for dy := 0; dy < scale; dy++ {
+			for dx := 0; dx < scale; dx++ {
+				d.drawer.SetPixel(x*scale+dx, y*scale+dy, val)
+			}
 		}
 	}
 	d.drawer.Draw()
 }
 
-func (d *Display) Stop() {
-	d.drawer.Stop()
-}
+// Palette are the colors of a pixel, indexed by the bitmask of the XO-CHIP planes it is set in: the
+// background, the first plane, the second plane and both.
+type Palette [4]color.Color
 
-type Drawer interface {
-	Clear()
-	SetPixel(x, y int)
-	Draw()
-	Stop()
+// DefaultPalette are the colors of the SDL window of the sdlui package.
+var DefaultPalette = Palette{
+	color.RGBA{0x00, 0x00, 0x00, 0xff},
+	color.RGBA{0xff, 0x00, 0x00, 0xff},
+	color.RGBA{0x00, 0xff, 0x00, 0xff},
+	color.RGBA{0xff, 0xff, 0x00, 0xff},
 }
 
-func NewSDLDisplay() *SDLDisplay {
-	window, err := sdl.CreateWindow("chip-8 emulator",
-		sdl.WINDOWPOS_UNDEFINED,
-		sdl.WINDOWPOS_UNDEFINED,
-		1280, 640, sdl.WINDOW_SHOWN)
-	if err != nil {
-		panic(err)
-	}
-
-	surface, err := window.GetSurface()
-	if err != nil {
-		panic(err)
+// Snapshot returns the current content of the display as an image of the 128x64 screen, every pixel of it
+// drawn as a scale x scale square, so that the low resolution pixels are 2*scale wide. Unlike the drawer,
+// the image shows the pixels set since the last Draw as well.
+func (d *Display) Snapshot(scale int, palette Palette) image.Image {
+	if scale < 1 {
+		scale = 1
 	}
-	surface.FillRect(nil, 0)
-
-	return &SDLDisplay{
-		window:  window,
-		surface: surface,
+	img := image.NewPaletted(image.Rect(0, 0, displayWidth*scale, displayHeight*scale), palette[:])
+	size := scale * displayWidth / int(d.W)
+	for i, val := range d.data[:int(d.W)*int(d.H)] {
+		if val == 0 {
+			continue
+		}
+		x, y := i%int(d.W)*size, i/int(d.W)*size
+		for dy := 0; dy < size; dy++ {
+			row := img.Pix[(y+dy)*img.Stride+x:]
+			for dx := 0; dx < size; dx++ {
+				row[dx] = val & 0x3
+			}
+		}
 	}
+	return img
 }
 
-type SDLDisplay struct {
-	sync.Mutex
-	window  *sdl.Window
-	surface *sdl.Surface
-}
-
-func (s *SDLDisplay) Clear() {
-	s.surface.FillRect(nil, 0)
-}
-
-func (s *SDLDisplay) SetPixel(x, y int) {
-	rect := sdl.Rect{int32(x) * 10, int32(y) * 10, 10, 10}
-	s.surface.FillRect(&rect, 0xffff0000)
-}
-
-func (s *SDLDisplay) Draw() {
-	s.window.UpdateSurface()
+func (d *Display) Stop() {
+	d.drawer.Stop()
 }
 
-func (s *SDLDisplay) Stop() {
-	s.window.Destroy()
+type Drawer interface {
+	Clear()
+	// SetPixel lights the pixel at x, y of the 128x64 screen. color is the bitmask of the
+	// planes the pixel is set in, from 1 to 3.
+	SetPixel(x, y int, color uint8)
+	Draw()
+	Stop()
 }
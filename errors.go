@@ -0,0 +1,46 @@
+package chip8
+
+import "fmt"
+
+// ErrUnknownOpcode is returned when the CPU executes an instruction it does not implement.
+type ErrUnknownOpcode struct {
+	// PC is the address of the instruction.
+	PC     uint16
+	Opcode uint16
+}
+
+func (e ErrUnknownOpcode) Error() string {
+	return fmt.Sprintf("unknown opcode %04X at 0x%03X", e.Opcode, e.PC)
+}
+
+// ErrStackOverflow is returned when a subroutine is called while the stack is full.
+type ErrStackOverflow struct {
+	// PC is the address of the call instruction.
+	PC uint16
+}
+
+func (e ErrStackOverflow) Error() string {
+	return fmt.Sprintf("stack overflow at 0x%03X", e.PC)
+}
+
+// ErrStackUnderflow is returned when returning from a subroutine while the stack is empty.
+type ErrStackUnderflow struct {
+	// PC is the address of the return instruction.
+	PC uint16
+}
+
+func (e ErrStackUnderflow) Error() string {
+	return fmt.Sprintf("stack underflow at 0x%03X", e.PC)
+}
+
+// ErrMemoryOutOfBounds is returned when an instruction accesses an address past the end of the memory.
+type ErrMemoryOutOfBounds struct {
+	// PC is the address of the instruction.
+	PC uint16
+	// Addr is the address that was accessed.
+	Addr int
+}
+
+func (e ErrMemoryOutOfBounds) Error() string {
+	return fmt.Sprintf("memory access out of bounds at 0x%03X: 0x%04X", e.PC, e.Addr)
+}
@@ -0,0 +1,82 @@
+package gdb
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// interruptByte is sent by GDB outside of any packet to stop the running target.
+const interruptByte = 0x03
+
+// packet is a packet received from GDB. valid is false when its checksum does not match.
+type packet struct {
+	data  string
+	valid bool
+}
+
+// readPackets reads the packets and the interrupts sent by GDB until r fails or done is closed.
+func readPackets(r io.Reader, packets chan<- packet, interrupts chan<- struct{}, done <-chan struct{}) error {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch b {
+		case interruptByte:
+			select {
+			case interrupts <- struct{}{}:
+			default:
+			}
+		case '$':
+			data, err := br.ReadString('#')
+			if err != nil {
+				return err
+			}
+			data = data[:len(data)-1]
+			var sum [2]byte
+			if _, err := io.ReadFull(br, sum[:]); err != nil {
+				return err
+			}
+			select {
+			case packets <- packet{data: data, valid: fmt.Sprintf("%02x", checksum(data)) == string(sum[:])}:
+			case <-done:
+				return nil
+			}
+		}
+		// The acknowledgments are ignored: the packets are sent over TCP, which does not lose them.
+	}
+}
+
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// writePacket writes data as a packet, escaping the characters which have a meaning in the protocol.
+func writePacket(w io.Writer, data string) error {
+	escaped := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '$', '#', '}', '*':
+			escaped = append(escaped, '}', c^0x20)
+		default:
+			escaped = append(escaped, c)
+		}
+	}
+	_, err := fmt.Fprintf(w, "$%s#%02x", escaped, checksum(string(escaped)))
+	return err
+}
+
+func decodeHex(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hexadecimal %q", s)
+	}
+	return b, nil
+}
@@ -0,0 +1,570 @@
+// Package gdb serves the GDB Remote Serial Protocol for the CHIP-8 CPU, so that GDB or any debugger frontend
+// speaking the protocol can attach to the emulator.
+//
+// The CPU is expected to run with Start: the server stops it at breakpoints and watchpoints through the CPU
+// hooks, which make Start pause, and continues it with Resume.
+package gdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imrenagi/chip8"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrKilled is returned by Serve when GDB kills the program.
+var ErrKilled = errors.New("killed by gdb")
+
+// Watchpoint kinds, as numbered by the Z packets.
+const (
+	watchWrite  = 2
+	watchRead   = 3
+	watchAccess = 4
+)
+
+type watchpoint struct {
+	kind int
+	addr uint16
+	size int
+}
+
+// Server serves a CPU to one GDB connection at a time.
+type Server struct {
+	cpu *chip8.CPU
+
+	mu          sync.Mutex
+	breakpoints map[uint16]bool
+	watchpoints []watchpoint
+	resumption  chip8.Resumption
+	interrupt   bool
+	// hit is the stop reply of the watchpoint triggered by the instruction being executed.
+	hit string
+
+	// stops receives the stop replies of the hooks stopping the execution.
+	stops chan string
+}
+
+// NewServer returns a Server for cpu. It must be created before the CPU starts, since it sets the hooks of
+// the CPU, and the CPU should start paused so that GDB attaches before the program runs.
+func NewServer(cpu *chip8.CPU) *Server {
+	s := &Server{
+		cpu:         cpu,
+		breakpoints: map[uint16]bool{},
+		stops:       make(chan string, 1),
+	}
+	cpu.Hooks.BeforeStep = s.beforeStep
+	cpu.Hooks.AfterStep = s.afterStep
+	cpu.Hooks.MemoryRead = func(addr int, _ uint8) { s.memoryAccess(addr, false) }
+	cpu.Hooks.MemoryWrite = func(addr int, _ uint8) { s.memoryAccess(addr, true) }
+	return s
+}
+
+// stop sends the stop reply to the connection and stops the execution.
+func (s *Server) stop(reply string) error {
+	select {
+	case s.stops <- reply:
+	default:
+	}
+	return chip8.ErrBreak
+}
+
+func (s *Server) beforeStep() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.interrupt {
+		s.interrupt = false
+		return s.stop("T02")
+	}
+	if !s.resumption.Skip() && s.breakpoints[s.cpu.PC] {
+		return s.stop("T05swbreak:;")
+	}
+	return nil
+}
+
+func (s *Server) afterStep() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hit != "" {
+		hit := s.hit
+		s.hit = ""
+		return s.stop(hit)
+	}
+	return nil
+}
+
+func (s *Server) memoryAccess(addr int, write bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hit != "" {
+		return
+	}
+	for _, w := range s.watchpoints {
+		if addr < int(w.addr) || addr >= int(w.addr)+w.size {
+			continue
+		}
+		switch {
+		case w.kind == watchWrite && write:
+			s.hit = fmt.Sprintf("T05watch:%x;", addr)
+		case w.kind == watchRead && !write:
+			s.hit = fmt.Sprintf("T05rwatch:%x;", addr)
+		case w.kind == watchAccess:
+			s.hit = fmt.Sprintf("T05awatch:%x;", addr)
+		default:
+			continue
+		}
+		return
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves the connections one after the other, until
+// ctx is cancelled or GDB kills the program, in which case ErrKilled is returned.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	log.Info().Msgf("waiting for gdb on %s", l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		log.Info().Msgf("gdb connected from %s", conn.RemoteAddr())
+		err = s.Serve(conn)
+		conn.Close()
+		if errors.Is(err, ErrKilled) {
+			return err
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Error().Err(err).Msg("gdb connection failed")
+		}
+	}
+}
+
+// session is the state of a connection.
+type session struct {
+	*Server
+	conn    io.ReadWriter
+	noAck   bool
+	running bool
+}
+
+// Serve serves a single connection until it is closed or GDB detaches.
+func (s *Server) Serve(conn io.ReadWriter) error {
+	packets := make(chan packet)
+	interrupts := make(chan struct{}, 1)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		readErr <- readPackets(conn, packets, interrupts, done)
+	}()
+
+	sess := &session{Server: s, conn: conn}
+	sess.interruptProgram()
+	// The CPU stopping by itself, when the program exits or fails, has no hook to report it.
+	halted := time.NewTicker(50 * time.Millisecond)
+	defer halted.Stop()
+
+	for {
+		select {
+		case err := <-readErr:
+			sess.detach()
+			return err
+		case p := <-packets:
+			if !sess.noAck {
+				ack := "+"
+				if !p.valid {
+					ack = "-"
+				}
+				if _, err := io.WriteString(conn, ack); err != nil {
+					return err
+				}
+			}
+			if !p.valid {
+				continue
+			}
+			closed, err := sess.handle(p.data)
+			if closed || err != nil {
+				return err
+			}
+		case <-interrupts:
+			if sess.running {
+				s.mu.Lock()
+				s.interrupt = true
+				s.mu.Unlock()
+			}
+		case reply := <-s.stops:
+			if sess.running {
+				sess.running = false
+				if err := sess.reply(reply); err != nil {
+					return err
+				}
+			}
+		case <-halted.C:
+			if sess.running && s.cpu.Halted() {
+				sess.running = false
+				if err := sess.reply("W00"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (sess *session) reply(data string) error {
+	return writePacket(sess.conn, data)
+}
+
+// interruptProgram stops the program if it runs, e.g. after the previous connection detached, since GDB
+// expects a stopped program when it attaches.
+func (sess *session) interruptProgram() {
+	if sess.cpu.Paused() || sess.cpu.Halted() {
+		return
+	}
+	sess.mu.Lock()
+	sess.interrupt = true
+	sess.mu.Unlock()
+	select {
+	case <-sess.stops:
+	case <-time.After(time.Second):
+	}
+}
+
+// detach removes the breakpoints and lets the program run.
+func (sess *session) detach() {
+	sess.mu.Lock()
+	sess.breakpoints = map[uint16]bool{}
+	sess.watchpoints = nil
+	sess.interrupt = false
+	sess.resumption.Resume()
+	sess.mu.Unlock()
+	sess.cpu.Resume()
+}
+
+// handle handles a packet. done is true when the connection must be closed.
+func (sess *session) handle(data string) (done bool, err error) {
+	if sess.running {
+		// Only an interrupt is expected while the program runs.
+		return false, nil
+	}
+	switch {
+	case data == "?":
+		return false, sess.reply("S05")
+	case strings.HasPrefix(data, "qSupported"):
+		return false, sess.reply("PacketSize=4000;qXfer:features:read+;QStartNoAckMode+;swbreak+")
+	case data == "QStartNoAckMode":
+		err := sess.reply("OK")
+		sess.noAck = true
+		return false, err
+	case strings.HasPrefix(data, "qXfer:features:read:target.xml:"):
+		return false, sess.reply(sess.readTargetXML(strings.TrimPrefix(data, "qXfer:features:read:target.xml:")))
+	case data == "qAttached":
+		return false, sess.reply("1")
+	case data == "qC":
+		return false, sess.reply("QC1")
+	case data == "qfThreadInfo":
+		return false, sess.reply("m1")
+	case data == "qsThreadInfo":
+		return false, sess.reply("l")
+	case strings.HasPrefix(data, "H"), strings.HasPrefix(data, "T"):
+		return false, sess.reply("OK")
+	case data == "vCont?":
+		return false, sess.reply("vCont;c;C;s;S")
+	case strings.HasPrefix(data, "vCont;"):
+		action := strings.TrimPrefix(data, "vCont;")
+		if strings.HasPrefix(action, "s") || strings.HasPrefix(action, "S") {
+			return false, sess.step()
+		}
+		sess.resume()
+		return false, nil
+	case data == "g":
+		return false, sess.readRegisters()
+	case strings.HasPrefix(data, "G"):
+		return false, sess.writeRegisters(data[1:])
+	case strings.HasPrefix(data, "p"):
+		return false, sess.readRegister(data[1:])
+	case strings.HasPrefix(data, "P"):
+		return false, sess.writeRegister(data[1:])
+	case strings.HasPrefix(data, "m"):
+		return false, sess.readMemory(data[1:])
+	case strings.HasPrefix(data, "M"):
+		return false, sess.writeMemory(data[1:])
+	case strings.HasPrefix(data, "c"):
+		if err := sess.setPC(data[1:]); err != nil {
+			return false, sess.reply("E01")
+		}
+		sess.resume()
+		return false, nil
+	case strings.HasPrefix(data, "s"):
+		if err := sess.setPC(data[1:]); err != nil {
+			return false, sess.reply("E01")
+		}
+		return false, sess.step()
+	case strings.HasPrefix(data, "Z"), strings.HasPrefix(data, "z"):
+		return false, sess.breakpoint(data[0] == 'Z', data[1:])
+	case data == "D" || strings.HasPrefix(data, "D;"):
+		err := sess.reply("OK")
+		sess.detach()
+		return true, err
+	case data == "k" || strings.HasPrefix(data, "vKill"):
+		if strings.HasPrefix(data, "vKill") {
+			sess.reply("OK")
+		}
+		return true, ErrKilled
+	}
+	// An empty reply tells GDB the packet is not supported.
+	return false, sess.reply("")
+}
+
+// readTargetXML returns the part of the target description requested by "offset,length".
+func (sess *session) readTargetXML(args string) string {
+	offset, length, err := parseRange(args)
+	if err != nil {
+		return "E01"
+	}
+	if offset >= len(targetXML) {
+		return "l"
+	}
+	end := offset + length
+	if end >= len(targetXML) {
+		return "l" + targetXML[offset:]
+	}
+	return "m" + targetXML[offset:end]
+}
+
+// setPC sets PC to the optional address argument of c and s.
+func (sess *session) setPC(arg string) error {
+	if arg == "" {
+		return nil
+	}
+	addr, err := strconv.ParseUint(arg, 16, 16)
+	if err != nil {
+		return err
+	}
+	sess.cpu.Exclusive(func() {
+		sess.cpu.PC = uint16(addr)
+	})
+	return nil
+}
+
+func (sess *session) resume() {
+	// A stop left over from before, e.g. a breakpoint reached while stepping, is not a reply to this packet.
+	select {
+	case <-sess.stops:
+	default:
+	}
+	sess.mu.Lock()
+	sess.resumption.Resume()
+	sess.mu.Unlock()
+	sess.running = true
+	sess.cpu.Resume()
+}
+
+func (sess *session) step() error {
+	if sess.cpu.Halted() {
+		return sess.reply("W00")
+	}
+	select {
+	case <-sess.stops:
+	default:
+	}
+	sess.mu.Lock()
+	sess.resumption.Resume()
+	sess.mu.Unlock()
+	err := sess.cpu.Step()
+	if errors.Is(err, chip8.ErrBreak) {
+		return sess.reply(<-sess.stops)
+	}
+	if err != nil {
+		// The instruction failed: it is reported as an illegal instruction.
+		return sess.reply("S04")
+	}
+	return sess.reply("S05")
+}
+
+func (sess *session) readRegisters() error {
+	var b strings.Builder
+	sess.cpu.Exclusive(func() {
+		for n := 0; n < numRegisters; n++ {
+			b.WriteString(encodeRegister(sess.cpu, n))
+		}
+	})
+	return sess.reply(b.String())
+}
+
+func (sess *session) writeRegisters(data string) error {
+	values := make([]uint16, numRegisters)
+	for n := range values {
+		v, size, err := decodeRegister(data, n)
+		if err != nil {
+			return sess.reply("E01")
+		}
+		values[n] = v
+		data = data[size:]
+	}
+	sess.cpu.Exclusive(func() {
+		for n, v := range values {
+			writeRegister(sess.cpu, n, v)
+		}
+	})
+	return sess.reply("OK")
+}
+
+func (sess *session) readRegister(arg string) error {
+	n, err := strconv.ParseUint(arg, 16, 8)
+	if err != nil || n >= numRegisters {
+		return sess.reply("E01")
+	}
+	var v string
+	sess.cpu.Exclusive(func() {
+		v = encodeRegister(sess.cpu, int(n))
+	})
+	return sess.reply(v)
+}
+
+func (sess *session) writeRegister(arg string) error {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 {
+		return sess.reply("E01")
+	}
+	n, err := strconv.ParseUint(parts[0], 16, 8)
+	if err != nil || n >= numRegisters {
+		return sess.reply("E01")
+	}
+	v, _, err := decodeRegister(parts[1], int(n))
+	if err != nil {
+		return sess.reply("E01")
+	}
+	sess.cpu.Exclusive(func() {
+		writeRegister(sess.cpu, int(n), v)
+	})
+	return sess.reply("OK")
+}
+
+func (sess *session) readMemory(args string) error {
+	addr, length, err := parseRange(args)
+	if err != nil {
+		return sess.reply("E01")
+	}
+	var data []byte
+	sess.cpu.Exclusive(func() {
+		mem := sess.cpu.Memory
+		if addr < len(mem) {
+			end := addr + length
+			if end > len(mem) {
+				end = len(mem)
+			}
+			data = append(data, mem[addr:end]...)
+		}
+	})
+	if len(data) == 0 && length > 0 {
+		return sess.reply("E14")
+	}
+	return sess.reply(fmt.Sprintf("%x", data))
+}
+
+func (sess *session) writeMemory(args string) error {
+	parts := strings.SplitN(args, ":", 2)
+	if len(parts) != 2 {
+		return sess.reply("E01")
+	}
+	addr, length, err := parseRange(parts[0])
+	if err != nil {
+		return sess.reply("E01")
+	}
+	data, err := decodeHex(parts[1])
+	if err != nil || len(data) != length {
+		return sess.reply("E01")
+	}
+	ok := true
+	sess.cpu.Exclusive(func() {
+		if addr+length > len(sess.cpu.Memory) {
+			ok = false
+			return
+		}
+		copy(sess.cpu.Memory[addr:], data)
+	})
+	if !ok {
+		return sess.reply("E14")
+	}
+	return sess.reply("OK")
+}
+
+// breakpoint handles "Ztype,addr,kind" and "ztype,addr,kind".
+func (sess *session) breakpoint(insert bool, args string) error {
+	parts := strings.Split(args, ",")
+	if len(parts) < 3 {
+		return sess.reply("E01")
+	}
+	typ, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return sess.reply("E01")
+	}
+	addr, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return sess.reply("E01")
+	}
+	size, err := strconv.ParseUint(parts[2], 16, 16)
+	if err != nil {
+		return sess.reply("E01")
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	switch typ {
+	case 0, 1:
+		if insert {
+			sess.breakpoints[uint16(addr)] = true
+		} else {
+			delete(sess.breakpoints, uint16(addr))
+		}
+	case watchWrite, watchRead, watchAccess:
+		w := watchpoint{kind: typ, addr: uint16(addr), size: int(size)}
+		if insert {
+			sess.watchpoints = append(sess.watchpoints, w)
+			break
+		}
+		for i, other := range sess.watchpoints {
+			if other == w {
+				sess.watchpoints = append(sess.watchpoints[:i], sess.watchpoints[i+1:]...)
+				break
+			}
+		}
+	default:
+		return writePacket(sess.conn, "")
+	}
+	return writePacket(sess.conn, "OK")
+}
+
+// parseRange parses "addr,length" in hexadecimal.
+func parseRange(args string) (int, int, error) {
+	parts := strings.SplitN(args, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q", args)
+	}
+	addr, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(addr), int(length), nil
+}
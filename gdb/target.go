@@ -0,0 +1,125 @@
+package gdb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/imrenagi/chip8"
+)
+
+// The registers are numbered V0 to VF, then I, PC, SP, DT and ST, as described by targetXML.
+const (
+	regI = 16 + iota
+	regPC
+	regSP
+	regDT
+	regST
+
+	numRegisters
+)
+
+// registerNames are the names of the registers, by number.
+var registerNames = func() []string {
+	names := make([]string, numRegisters)
+	for i := 0; i < 16; i++ {
+		names[i] = fmt.Sprintf("v%x", i)
+	}
+	names[regI], names[regPC], names[regSP], names[regDT], names[regST] = "i", "pc", "sp", "dt", "st"
+	return names
+}()
+
+// registerSize returns the size of register n in bytes.
+func registerSize(n int) int {
+	if n == regI || n == regPC {
+		return 2
+	}
+	return 1
+}
+
+// targetXML describes the register file of the CHIP-8 to GDB.
+var targetXML = func() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.chip8.core">
+`)
+	for n, name := range registerNames {
+		typ := "uint8"
+		switch n {
+		case regI:
+			typ = "data_ptr"
+		case regPC:
+			typ = "code_ptr"
+		}
+		fmt.Fprintf(&b, "    <reg name=\"%s\" bitsize=\"%d\" type=\"%s\" regnum=\"%d\"/>\n", name, registerSize(n)*8, typ, n)
+	}
+	b.WriteString("  </feature>\n</target>\n")
+	return b.String()
+}()
+
+// readRegister returns the value of register n.
+func readRegister(c *chip8.CPU, n int) uint16 {
+	switch {
+	case n < 16:
+		return uint16(c.V[n])
+	case n == regI:
+		return c.I
+	case n == regPC:
+		return c.PC
+	case n == regSP:
+		return uint16(c.SP)
+	case n == regDT:
+		return uint16(c.DT)
+	case n == regST:
+		return uint16(c.ST)
+	}
+	return 0
+}
+
+// writeRegister sets register n to v.
+func writeRegister(c *chip8.CPU, n int, v uint16) {
+	switch {
+	case n < 16:
+		c.V[n] = uint8(v)
+	case n == regI:
+		c.I = v
+	case n == regPC:
+		c.PC = v
+	case n == regSP:
+		if int(v) <= len(c.Stack) {
+			c.SP = uint8(v)
+		}
+	case n == regDT:
+		c.DT = uint8(v)
+	case n == regST:
+		c.ST = uint8(v)
+	}
+}
+
+// encodeRegister returns register n as hexadecimal bytes in the little-endian order GDB expects.
+func encodeRegister(c *chip8.CPU, n int) string {
+	v := readRegister(c, n)
+	if registerSize(n) == 1 {
+		return fmt.Sprintf("%02x", v)
+	}
+	return fmt.Sprintf("%02x%02x", v&0xFF, v>>8)
+}
+
+// decodeRegister parses the hexadecimal little-endian value of register n at the start of data and returns
+// the number of characters read.
+func decodeRegister(data string, n int) (uint16, int, error) {
+	size := registerSize(n) * 2
+	if len(data) < size {
+		return 0, 0, fmt.Errorf("short value for register %d", n)
+	}
+	b, err := decodeHex(data[:size])
+	if err != nil {
+		return 0, 0, err
+	}
+	v := uint16(b[0])
+	if len(b) == 2 {
+		v |= uint16(b[1]) << 8
+	}
+	return v, size, nil
+}
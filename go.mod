@@ -3,13 +3,13 @@ module github.com/imrenagi/chip8
 go 1.19
 
 require (
+	github.com/gordonklaus/portaudio v0.0.0-20221027163845-7c3b689db3cc
 	github.com/rs/zerolog v1.28.0
 	github.com/veandco/go-sdl2 v0.4.27
+	golang.org/x/sys v0.3.0
 )
 
 require (
-	github.com/gordonklaus/portaudio v0.0.0-20221027163845-7c3b689db3cc // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.16 // indirect
-	golang.org/x/sys v0.3.0 // indirect
 )
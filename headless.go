@@ -0,0 +1,71 @@
+package chip8
+
+import "sync"
+
+// NewHeadlessCPU returns a CPU drawing to a HeadlessDrawer and playing no sound,
+// so that it can run without SDL or PortAudio.
+func NewHeadlessCPU(quirks Quirks) *CPU {
+	display := NewHeadlessDisplay()
+	return NewCPU(&display, NewKeyboard(), NewNullAudioSink(), quirks)
+}
+
+// NewHeadlessDisplay returns a Display drawing to a HeadlessDrawer.
+func NewHeadlessDisplay() Display {
+	return NewDisplay(NewHeadlessDrawer())
+}
+
+// NewHeadlessDrawer returns a HeadlessDrawer with every pixel off and no frame drawn yet.
+func NewHeadlessDrawer() *HeadlessDrawer {
+	return &HeadlessDrawer{}
+}
+
+// HeadlessDrawer is a Drawer keeping the frames in memory instead of showing them.
+type HeadlessDrawer struct {
+	sync.Mutex
+	back   [displayWidth * displayHeight]uint8
+	front  [displayWidth * displayHeight]uint8
+	frames int
+}
+
+func (h *HeadlessDrawer) Clear() {
+	h.Lock()
+	defer h.Unlock()
+	h.back = [displayWidth * displayHeight]uint8{}
+}
+
+func (h *HeadlessDrawer) SetPixel(x, y int, color uint8) {
+	h.Lock()
+	defer h.Unlock()
+	h.back[y*displayWidth+x] = color
+}
+
+func (h *HeadlessDrawer) Draw() {
+	h.Lock()
+	defer h.Unlock()
+	h.front = h.back
+	h.frames++
+}
+
+func (h *HeadlessDrawer) Stop() {}
+
+// Pixel returns the color of the pixel at x, y of the 128x64 screen in the last frame drawn,
+// 0 when it is off.
+func (h *HeadlessDrawer) Pixel(x, y int) uint8 {
+	h.Lock()
+	defer h.Unlock()
+	return h.front[y*displayWidth+x]
+}
+
+// Frame returns a copy of the last frame drawn, one byte per pixel of the 128x64 screen, row by row.
+func (h *HeadlessDrawer) Frame() []uint8 {
+	h.Lock()
+	defer h.Unlock()
+	return append([]uint8(nil), h.front[:]...)
+}
+
+// Frames returns the number of frames drawn.
+func (h *HeadlessDrawer) Frames() int {
+	h.Lock()
+	defer h.Unlock()
+	return h.frames
+}
@@ -0,0 +1,59 @@
+package chip8
+
+import "errors"
+
+// ErrBreak is returned by a hook to stop the execution, e.g. at a breakpoint. Start pauses when it gets
+// ErrBreak instead of halting, and Resume continues from where it stopped.
+var ErrBreak = errors.New("break")
+
+// Hooks are called while the CPU executes instructions, so that tools such as debuggers can follow and
+// stop the execution. Any of them may be nil.
+//
+// The hooks are called while the state of the CPU is locked: they may read and change it directly, but
+// must not call the methods which lock it, such as Step or Snapshot.
+type Hooks struct {
+	// BeforeStep is called before the instruction at PC is fetched. When it returns an error, the
+	// instruction is not executed and Step returns the error.
+	BeforeStep func() error
+	// AfterStep is called after an instruction is executed. Its error is returned by Step.
+	AfterStep func() error
+	// Error is called when an instruction fails, e.g. with ErrStackOverflow, and its result is returned by
+	// Step instead. Returning ErrBreak makes Start pause at the failing instruction instead of halting.
+	Error func(err error) error
+	// MemoryRead is called for every byte an instruction reads from memory, besides its own opcode.
+	MemoryRead func(addr int, val uint8)
+	// MemoryWrite is called for every byte an instruction writes to memory, before it is written: Memory
+	// still holds the previous value at addr.
+	MemoryWrite func(addr int, val uint8)
+	// Tick is called at every tick of the 60Hz timer, once the timers are decremented, e.g. to record the
+	// sound and the display frame by frame. It is not called while the CPU is paused.
+	Tick func()
+}
+
+// Exclusive runs f while no instruction executes, so that f can read or change the state of the CPU
+// while Start runs. f must not call the methods which lock the state, such as Step or Snapshot.
+func (c *CPU) Exclusive(f func()) {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	f()
+}
+
+// Resumption lets a debugger continue from the breakpoint it stopped at: the instruction at the breakpoint
+// runs once the execution resumes, instead of stopping at it again. It is not safe for concurrent use, the
+// debuggers guard it with the lock of their breakpoints.
+type Resumption struct {
+	pending bool
+}
+
+// Resume makes the next instruction run without checking the breakpoints.
+func (r *Resumption) Resume() {
+	r.pending = true
+}
+
+// Skip reports whether the breakpoints must be ignored for the instruction about to execute, which is the
+// case for the first one after Resume. It must be called by BeforeStep once per instruction.
+func (r *Resumption) Skip() bool {
+	skip := r.pending
+	r.pending = false
+	return skip
+}
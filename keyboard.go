@@ -1,49 +1,31 @@
 package chip8
 
-import (
-	"sync"
+import "sync"
 
-	"github.com/veandco/go-sdl2/sdl"
-)
+// noKey is the key of the events of the host keys which are not bound to the keypad.
+const noKey = 0xFF
 
-var (
-	keyMap = map[sdl.Scancode]uint8{
-		sdl.SCANCODE_X: 0x0, // 0
-		sdl.SCANCODE_1: 0x1, // 1
-		sdl.SCANCODE_2: 0x2, // 2
-		sdl.SCANCODE_3: 0x3, // 3
-		sdl.SCANCODE_Q: 0x4, // 4
-		sdl.SCANCODE_W: 0x5, // 5
-		sdl.SCANCODE_E: 0x6, // 6
-		sdl.SCANCODE_A: 0x7, // 7
-		sdl.SCANCODE_S: 0x8, // 8
-		sdl.SCANCODE_D: 0x9, // 9
-		sdl.SCANCODE_Z: 0xA, // A
-		sdl.SCANCODE_C: 0xB, // B
-		sdl.SCANCODE_4: 0xC, // C
-		sdl.SCANCODE_R: 0xD, // D
-		sdl.SCANCODE_F: 0xE, // E
-		sdl.SCANCODE_V: 0xF, // F
+// NewKeyEvent returns the event of the key of the hex keypad, from 0x0 to 0xF, being pressed or released.
+func NewKeyEvent(isPressed bool, key uint8) KeyEvent {
+	if key > 0xF {
+		key = noKey
 	}
-)
-
-func NewKeyEvent(isPressed bool, scancode sdl.Scancode) KeyEvent {
 	return KeyEvent{
-		pressed:  isPressed,
-		scancode: scancode,
+		pressed: isPressed,
+		key:     key,
 	}
 }
 
 type KeyEvent struct {
-	pressed  bool
-	scancode sdl.Scancode
+	pressed bool
+	key     uint8
 }
 
 func NewKeyboard() *Keyboard {
 	k := &Keyboard{
 		quitCh:       make(chan struct{}),
 		acceptCh:     make(chan KeyEvent, 10),
-		pressEventCh: make(chan uint8),
+		pressEventCh: make(chan uint8, 1),
 	}
 	go k.Observe()
 	return k
@@ -69,18 +51,18 @@ func (k *Keyboard) Observe() {
 }
 
 func (k *Keyboard) process(ev KeyEvent) {
-	idx, ok := keyMap[ev.scancode]
-	if !ok {
+	if ev.key == noKey {
 		return
 	}
+	idx := ev.key
+	k.Lock()
+	k.keyState[idx] = ev.pressed
+	k.Unlock()
 	if ev.pressed {
-		k.keyState[idx] = true
 		select {
 		case k.pressEventCh <- idx:
 		default:
 		}
-	} else {
-		k.keyState[idx] = false
 	}
 }
 
@@ -100,3 +82,25 @@ func (k *Keyboard) IsBeingPressed(key uint8) bool {
 func (k *Keyboard) PressedEventCh() <-chan uint8 {
 	return k.pressEventCh
 }
+
+// DiscardPressedEvents drops the key press waiting to be received from PressedEventCh, if any.
+func (k *Keyboard) DiscardPressedEvents() {
+	select {
+	case <-k.pressEventCh:
+	default:
+	}
+}
+
+// State returns whether each of the 16 keys is being pressed.
+func (k *Keyboard) State() [16]bool {
+	k.Lock()
+	defer k.Unlock()
+	return k.keyState
+}
+
+// SetState sets whether each of the 16 keys is being pressed.
+func (k *Keyboard) SetState(state [16]bool) {
+	k.Lock()
+	defer k.Unlock()
+	k.keyState = state
+}
@@ -0,0 +1,124 @@
+package chip8
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Keymap binds the keys of the host to the keys of the hex keypad, indexed from 0x0 to 0xF. The host keys are
+// named like the SDL scancodes, e.g. "X", "1", "Up", "Space" or "Keypad 8", whatever the frontend, and a key
+// of the keypad may be bound to several of them.
+//
+// It is stored as a JSON object from the keys of the keypad to the names of their host keys, e.g.
+// {"5": ["W", "Space"], "8": ["S", "Down"]}.
+type Keymap [16][]string
+
+var (
+	// DefaultKeymap binds the 4x4 block from 1 to V to the keypad, laid out like it. The SDL window and the
+	// browser use the position of the keys, so it is the same block on the AZERTY and Dvorak keyboards.
+	DefaultKeymap = Keymap{
+		0x1: {"1"}, 0x2: {"2"}, 0x3: {"3"}, 0xC: {"4"},
+		0x4: {"Q"}, 0x5: {"W"}, 0x6: {"E"}, 0xD: {"R"},
+		0x7: {"A"}, 0x8: {"S"}, 0x9: {"D"}, 0xE: {"F"},
+		0xA: {"Z"}, 0x0: {"X"}, 0xB: {"C"}, 0xF: {"V"},
+	}
+
+	// ArrowsKeymap adds the arrows and Space to the DefaultKeymap, on 2, 4, 6, 8 and 5, which most games
+	// move and act with.
+	ArrowsKeymap = DefaultKeymap.With(0x2, "Up").With(0x4, "Left").With(0x6, "Right").With(0x8, "Down").
+			With(0x5, "Space")
+
+	// KeymapPresets maps the names accepted on the command line to their keymaps.
+	KeymapPresets = map[string]Keymap{
+		"default": DefaultKeymap,
+		"arrows":  ArrowsKeymap,
+	}
+)
+
+// Key returns the key of the keypad bound to the host key name, and whether there is one. The names are
+// not case sensitive.
+func (k Keymap) Key(name string) (uint8, bool) {
+	for key, names := range k {
+		for _, n := range names {
+			if strings.EqualFold(n, name) {
+				return uint8(key), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// With returns a copy of the keymap with the host key name bound to key as well. The host key is unbound
+// from the other keys.
+func (k Keymap) With(key uint8, name string) Keymap {
+	var m Keymap
+	for i, names := range k {
+		for _, n := range names {
+			if !strings.EqualFold(n, name) {
+				m[i] = append(m[i], n)
+			}
+		}
+	}
+	m[key&0xF] = append(m[key&0xF], name)
+	return m
+}
+
+func (k Keymap) MarshalJSON() ([]byte, error) {
+	m := make(map[string][]string)
+	for key, names := range k {
+		if len(names) > 0 {
+			m[fmt.Sprintf("%X", key)] = names
+		}
+	}
+	return json.Marshal(m)
+}
+
+func (k *Keymap) UnmarshalJSON(b []byte) error {
+	var m map[string][]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*k = Keymap{}
+	for s, names := range m {
+		key, err := strconv.ParseUint(s, 16, 8)
+		if err != nil || key > 0xF {
+			return fmt.Errorf("invalid key %q of the keypad, it goes from 0 to F", s)
+		}
+		for _, name := range names {
+			*k = k.With(uint8(key), name)
+		}
+	}
+	return nil
+}
+
+// LoadKeymap reads a keymap from a JSON file.
+func LoadKeymap(path string) (Keymap, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Keymap{}, err
+	}
+	var k Keymap
+	if err := json.Unmarshal(b, &k); err != nil {
+		return Keymap{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// Save writes the keymap to a JSON file, one key of the keypad per line.
+func (k Keymap) Save(path string) error {
+	var lines []string
+	for key, names := range k {
+		if len(names) == 0 {
+			continue
+		}
+		b, err := json.Marshal(names)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("  \"%X\": %s", key, b))
+	}
+	return os.WriteFile(path, []byte("{\n"+strings.Join(lines, ",\n")+"\n}\n"), 0644)
+}
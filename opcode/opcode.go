@@ -0,0 +1,182 @@
+// Package opcode decodes the CHIP-8, SUPER-CHIP and XO-CHIP instructions.
+// It holds the decode table shared by the CPU and the tools inspecting programs.
+package opcode
+
+// Op identifies an instruction, independently of its operands.
+type Op uint8
+
+const (
+	Invalid   Op = iota
+	CLS          // 00E0 - CLS
+	RET          // 00EE - RET
+	SCD          // 00Cn - SCD nibble
+	SCU          // 00Dn - SCU nibble
+	SCR          // 00FB - SCR
+	SCL          // 00FC - SCL
+	EXIT         // 00FD - EXIT
+	LOW          // 00FE - LOW
+	HIGH         // 00FF - HIGH
+	JP           // 1nnn - JP addr
+	CALL         // 2nnn - CALL addr
+	SEVxByte     // 3xkk - SE Vx, byte
+	SNEVxByte    // 4xkk - SNE Vx, byte
+	SEVxVy       // 5xy0 - SE Vx, Vy
+	SaveRange    // 5xy2 - LD [I], Vx-Vy
+	LoadRange    // 5xy3 - LD Vx-Vy, [I]
+	LDVxByte     // 6xkk - LD Vx, byte
+	ADDVxByte    // 7xkk - ADD Vx, byte
+	LDVxVy       // 8xy0 - LD Vx, Vy
+	OR           // 8xy1 - OR Vx, Vy
+	AND          // 8xy2 - AND Vx, Vy
+	XOR          // 8xy3 - XOR Vx, Vy
+	ADDVxVy      // 8xy4 - ADD Vx, Vy
+	SUB          // 8xy5 - SUB Vx, Vy
+	SHR          // 8xy6 - SHR Vx {, Vy}
+	SUBN         // 8xy7 - SUBN Vx, Vy
+	SHL          // 8xyE - SHL Vx {, Vy}
+	SNEVxVy      // 9xy0 - SNE Vx, Vy
+	LDI          // Annn - LD I, addr
+	JPV0         // Bnnn - JP V0, addr
+	RND          // Cxkk - RND Vx, byte
+	DRW          // Dxyn - DRW Vx, Vy, nibble
+	SKP          // Ex9E - SKP Vx
+	SKNP         // ExA1 - SKNP Vx
+	LDILong      // F000 nnnn - LD I, long addr
+	PLANE        // Fn01 - PLANE n
+	AUDIO        // F002 - AUDIO
+	LDVxDT       // Fx07 - LD Vx, DT
+	LDVxK        // Fx0A - LD Vx, K
+	LDDTVx       // Fx15 - LD DT, Vx
+	LDSTVx       // Fx18 - LD ST, Vx
+	ADDIVx       // Fx1E - ADD I, Vx
+	LDFVx        // Fx29 - LD F, Vx
+	LDHFVx       // Fx30 - LD HF, Vx
+	LDBVx        // Fx33 - LD B, Vx
+	PITCH        // Fx3A - PITCH Vx
+	LDIVx        // Fx55 - LD [I], Vx
+	LDVxI        // Fx65 - LD Vx, [I]
+	LDRVx        // Fx75 - LD R, Vx
+	LDVxR        // Fx85 - LD Vx, R
+)
+
+// entry matches the opcodes for which opcode&mask == pattern.
+type entry struct {
+	mask, pattern uint16
+	op            Op
+	name          string
+}
+
+// table is the decode table. The first matching entry wins, so the exact opcodes come before the patterns
+// they could be mistaken for.
+var table = []entry{
+	{0xFFFF, 0x00E0, CLS, "CLS"},
+	{0xFFFF, 0x00EE, RET, "RET"},
+	{0xFFF0, 0x00C0, SCD, "SCD"},
+	{0xFFF0, 0x00D0, SCU, "SCU"},
+	{0xFFFF, 0x00FB, SCR, "SCR"},
+	{0xFFFF, 0x00FC, SCL, "SCL"},
+	{0xFFFF, 0x00FD, EXIT, "EXIT"},
+	{0xFFFF, 0x00FE, LOW, "LOW"},
+	{0xFFFF, 0x00FF, HIGH, "HIGH"},
+	{0xF000, 0x1000, JP, "JP"},
+	{0xF000, 0x2000, CALL, "CALL"},
+	{0xF000, 0x3000, SEVxByte, "SE"},
+	{0xF000, 0x4000, SNEVxByte, "SNE"},
+	{0xF00F, 0x5000, SEVxVy, "SE"},
+	{0xF00F, 0x5002, SaveRange, "LD"},
+	{0xF00F, 0x5003, LoadRange, "LD"},
+	{0xF000, 0x6000, LDVxByte, "LD"},
+	{0xF000, 0x7000, ADDVxByte, "ADD"},
+	{0xF00F, 0x8000, LDVxVy, "LD"},
+	{0xF00F, 0x8001, OR, "OR"},
+	{0xF00F, 0x8002, AND, "AND"},
+	{0xF00F, 0x8003, XOR, "XOR"},
+	{0xF00F, 0x8004, ADDVxVy, "ADD"},
+	{0xF00F, 0x8005, SUB, "SUB"},
+	{0xF00F, 0x8006, SHR, "SHR"},
+	{0xF00F, 0x8007, SUBN, "SUBN"},
+	{0xF00F, 0x800E, SHL, "SHL"},
+	{0xF00F, 0x9000, SNEVxVy, "SNE"},
+	{0xF000, 0xA000, LDI, "LD"},
+	{0xF000, 0xB000, JPV0, "JP"},
+	{0xF000, 0xC000, RND, "RND"},
+	{0xF000, 0xD000, DRW, "DRW"},
+	{0xF0FF, 0xE09E, SKP, "SKP"},
+	{0xF0FF, 0xE0A1, SKNP, "SKNP"},
+	{0xFFFF, 0xF000, LDILong, "LD"},
+	{0xFFFF, 0xF002, AUDIO, "AUDIO"},
+	{0xF0FF, 0xF001, PLANE, "PLANE"},
+	{0xF0FF, 0xF007, LDVxDT, "LD"},
+	{0xF0FF, 0xF00A, LDVxK, "LD"},
+	{0xF0FF, 0xF015, LDDTVx, "LD"},
+	{0xF0FF, 0xF018, LDSTVx, "LD"},
+	{0xF0FF, 0xF01E, ADDIVx, "ADD"},
+	{0xF0FF, 0xF029, LDFVx, "LD"},
+	{0xF0FF, 0xF030, LDHFVx, "LD"},
+	{0xF0FF, 0xF033, LDBVx, "LD"},
+	{0xF0FF, 0xF03A, PITCH, "PITCH"},
+	{0xF0FF, 0xF055, LDIVx, "LD"},
+	{0xF0FF, 0xF065, LDVxI, "LD"},
+	{0xF0FF, 0xF075, LDRVx, "LD"},
+	{0xF0FF, 0xF085, LDVxR, "LD"},
+}
+
+// Instruction is a decoded instruction with all the ways its operands can be read.
+// Which of them are meaningful depends on Op.
+type Instruction struct {
+	Op     Op
+	Opcode uint16
+
+	X   uint8  // the lower 4 bits of the high byte
+	Y   uint8  // the upper 4 bits of the low byte
+	N   uint8  // the lowest 4 bits
+	KK  uint8  // the low byte
+	NNN uint16 // the lowest 12 bits
+}
+
+// Decode decodes opcode. Op is Invalid when the opcode is not an instruction.
+// The address of F000 nnnn is in the word following it and is not part of the Instruction.
+func Decode(opcode uint16) Instruction {
+	in := Instruction{
+		Opcode: opcode,
+		X:      uint8(opcode & 0x0F00 >> 8),
+		Y:      uint8(opcode & 0x00F0 >> 4),
+		N:      uint8(opcode & 0x000F),
+		KK:     uint8(opcode & 0x00FF),
+		NNN:    opcode & 0x0FFF,
+	}
+	for _, e := range table {
+		if opcode&e.mask == e.pattern {
+			in.Op = e.op
+			break
+		}
+	}
+	return in
+}
+
+// Size returns the length of the instruction in bytes.
+func (op Op) Size() int {
+	if op == LDILong {
+		return 4
+	}
+	return 2
+}
+
+// Mnemonic returns the name of the instruction in the Cowgod's Chip-8 Technical Reference notation, e.g. LD.
+func (op Op) Mnemonic() string {
+	for _, e := range table {
+		if e.op == op {
+			return e.name
+		}
+	}
+	return "???"
+}
+
+// IsSkip reports whether the instruction conditionally skips the next one.
+func (op Op) IsSkip() bool {
+	switch op {
+	case SEVxByte, SNEVxByte, SEVxVy, SNEVxVy, SKP, SKNP:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+// Package portaudio plays the buzzer of the emulator on the default output device with PortAudio.
+package portaudio
+
+import (
+	"sync"
+
+	pa "github.com/gordonklaus/portaudio"
+	"github.com/imrenagi/chip8"
+)
+
+// Sink plays the buzzer on the default output device with PortAudio.
+type Sink struct {
+	*chip8.Tone
+	stream *pa.Stream
+
+	mu      sync.Mutex
+	playing bool
+}
+
+// NewSink initializes PortAudio and opens the default output device.
+func NewSink(config chip8.ToneConfig) (*Sink, error) {
+	tone, err := chip8.NewTone(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := pa.Initialize(); err != nil {
+		return nil, err
+	}
+	p := &Sink{Tone: tone}
+	p.stream, err = pa.OpenDefaultStream(0, 2, chip8.SampleRate, 0, p.processAudio)
+	if err != nil {
+		pa.Terminate()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Sink) processAudio(out [][]float32) {
+	p.Generate(out[0])
+	copy(out[1], out[0])
+}
+
+func (p *Sink) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.playing {
+		return nil
+	}
+	p.SetOn(true)
+	if err := p.stream.Start(); err != nil {
+		return err
+	}
+	p.playing = true
+	return nil
+}
+
+func (p *Sink) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.playing {
+		return nil
+	}
+	p.SetOn(false)
+	p.playing = false
+	return p.stream.Stop()
+}
+
+func (p *Sink) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.stream.Close()
+	if terr := pa.Terminate(); err == nil {
+		err = terr
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package chip8
+
+import "github.com/rs/zerolog/log"
+
+// Policy decides how the CPU handles a program that overflows the stack or accesses memory out of bounds.
+type Policy uint8
+
+const (
+	// PolicyWrap wraps the stack pointer or the address around, like the original hardware did.
+	PolicyWrap Policy = iota
+	// PolicyTrap stops the instruction and returns the violation as an error.
+	PolicyTrap
+	// PolicyLog logs the violation as a warning, then wraps around and continues.
+	PolicyLog
+)
+
+// Protection holds the policy for every kind of violation.
+type Protection struct {
+	StackOverflow     Policy
+	StackUnderflow    Policy
+	MemoryOutOfBounds Policy
+}
+
+// DefaultProtection traps on the stack errors, which are almost always fatal bugs,
+// and wraps memory accesses around as the original interpreters did.
+var DefaultProtection = Protection{
+	StackOverflow:     PolicyTrap,
+	StackUnderflow:    PolicyTrap,
+	MemoryOutOfBounds: PolicyWrap,
+}
+
+// violation applies policy to err. It returns err when the instruction must stop.
+func (c *CPU) violation(policy Policy, err error) error {
+	switch policy {
+	case PolicyTrap:
+		return err
+	case PolicyLog:
+		log.Warn().Err(err).Msg("continuing after violation")
+	}
+	return nil
+}
+
+// readMemory returns the byte at addr, applying the MemoryOutOfBounds policy when addr is past the end of the memory.
+func (c *CPU) readMemory(addr int) (uint8, error) {
+	val, err := c.fetchMemory(addr)
+	if err != nil {
+		return 0, err
+	}
+	if c.Hooks.MemoryRead != nil {
+		c.Hooks.MemoryRead(addr%len(c.Memory), val)
+	}
+	return val, nil
+}
+
+// fetchMemory returns the byte at addr like readMemory, for the bytes of the instructions themselves,
+// which are not reported to the MemoryRead hook.
+func (c *CPU) fetchMemory(addr int) (uint8, error) {
+	addr, err := c.memoryAddr(addr)
+	if err != nil {
+		return 0, err
+	}
+	return c.Memory[addr], nil
+}
+
+// writeMemory sets the byte at addr, applying the MemoryOutOfBounds policy when addr is past the end of the memory.
+func (c *CPU) writeMemory(addr int, val uint8) error {
+	addr, err := c.memoryAddr(addr)
+	if err != nil {
+		return err
+	}
+	if c.Hooks.MemoryWrite != nil {
+		c.Hooks.MemoryWrite(addr, val)
+	}
+	c.Memory[addr] = val
+	return nil
+}
+
+func (c *CPU) memoryAddr(addr int) (int, error) {
+	if addr < len(c.Memory) {
+		return addr, nil
+	}
+	if err := c.violation(c.Protection.MemoryOutOfBounds, ErrMemoryOutOfBounds{PC: c.opPC, Addr: addr}); err != nil {
+		return 0, err
+	}
+	return addr % len(c.Memory), nil
+}
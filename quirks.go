@@ -0,0 +1,109 @@
+package chip8
+
+// IncrementMode describes how Fx55 and Fx65 leave the I register once they are done.
+type IncrementMode uint8
+
+const (
+	// IncrementNone leaves I untouched.
+	IncrementNone IncrementMode = iota
+	// IncrementX adds x to I (CHIP-48).
+	IncrementX
+	// IncrementXPlusOne adds x + 1 to I, leaving it right after the last byte accessed (COSMAC VIP).
+	IncrementXPlusOne
+)
+
+// Quirks selects between the behaviors different CHIP-8 interpreters implemented
+// for the instructions whose semantics were never agreed upon.
+type Quirks struct {
+	// ShiftUsesVY makes 8xy6 and 8xyE shift Vy and store the result in Vx.
+	// When false, Vx is shifted in place and Vy is ignored.
+	ShiftUsesVY bool
+
+	// LoadStoreIncrement controls what happens to I after Fx55 and Fx65.
+	LoadStoreIncrement IncrementMode
+
+	// JumpUsesVX makes Bxnn jump to xnn + Vx instead of nnn + V0.
+	JumpUsesVX bool
+
+	// LogicResetsVF makes 8xy1, 8xy2 and 8xy3 set VF to 0.
+	LogicResetsVF bool
+
+	// WrapSprites makes the parts of a sprite drawn past the edge of the screen
+	// wrap around to the opposite side. When false, they are clipped.
+	// The origin of a sprite always wraps.
+	WrapSprites bool
+
+	// ExtendedMemory gives programs the 64KB address space of XO-CHIP instead of 4KB.
+	ExtendedMemory bool
+}
+
+var (
+	// QuirksLegacy is the behavior of this emulator before the quirks could be selected, which the ROMs
+	// already played with it rely on: shifts in place, I untouched by Fx55 and Fx65, VF kept by the logic
+	// operations and sprites clipped at the edge of the screen. It is the default.
+	QuirksLegacy = Quirks{
+		ShiftUsesVY:        false,
+		LoadStoreIncrement: IncrementNone,
+		JumpUsesVX:         false,
+		LogicResetsVF:      false,
+		WrapSprites:        false,
+	}
+
+	// QuirksCOSMACVIP is the behavior of the original interpreter on the COSMAC VIP.
+	QuirksCOSMACVIP = Quirks{
+		ShiftUsesVY:        true,
+		LoadStoreIncrement: IncrementXPlusOne,
+		JumpUsesVX:         false,
+		LogicResetsVF:      true,
+		WrapSprites:        false,
+	}
+
+	// QuirksCHIP48 is the behavior of CHIP-48 on the HP-48 calculators.
+	QuirksCHIP48 = Quirks{
+		ShiftUsesVY:        false,
+		LoadStoreIncrement: IncrementX,
+		JumpUsesVX:         true,
+		LogicResetsVF:      false,
+		WrapSprites:        false,
+	}
+
+	// QuirksSuperChip11 is the behavior of SUPER-CHIP 1.1.
+	QuirksSuperChip11 = Quirks{
+		ShiftUsesVY:        false,
+		LoadStoreIncrement: IncrementNone,
+		JumpUsesVX:         true,
+		LogicResetsVF:      false,
+		WrapSprites:        false,
+	}
+
+	// QuirksModern is the behavior of Octo and most modern interpreters.
+	QuirksModern = Quirks{
+		ShiftUsesVY:        true,
+		LoadStoreIncrement: IncrementXPlusOne,
+		JumpUsesVX:         false,
+		LogicResetsVF:      false,
+		WrapSprites:        true,
+	}
+
+	// QuirksXOChip is the behavior of XO-CHIP, the Octo extension with 64KB of memory,
+	// bitplanes and programmable audio.
+	QuirksXOChip = Quirks{
+		ShiftUsesVY:        true,
+		LoadStoreIncrement: IncrementXPlusOne,
+		JumpUsesVX:         false,
+		LogicResetsVF:      false,
+		WrapSprites:        true,
+		ExtendedMemory:     true,
+	}
+
+	// QuirksPresets maps the names accepted on the command line to their quirks.
+	QuirksPresets = map[string]Quirks{
+		"legacy": QuirksLegacy,
+		"vip":    QuirksCOSMACVIP,
+		"chip48": QuirksCHIP48,
+		"schip":  QuirksSuperChip11,
+		"modern": QuirksModern,
+		"octo":   QuirksModern,
+		"xochip": QuirksXOChip,
+	}
+)
@@ -0,0 +1,171 @@
+package chip8
+
+import "testing"
+
+// runProgram loads program at 0x200 on a headless CPU with quirks, lets setup prepare the machine
+// and executes one instruction for each 2 bytes of the program.
+func runProgram(t *testing.T, quirks Quirks, program []byte, setup func(c *CPU)) *CPU {
+	t.Helper()
+	c := NewHeadlessCPU(quirks)
+	if err := c.LoadProgramBytes(program); err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(c)
+	}
+	for i := 0; i < len(program)/2; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	return c
+}
+
+func TestQuirksShift(t *testing.T) {
+	tests := []struct {
+		preset string
+		opcode []byte
+		wantVX uint8
+		wantVF uint8
+	}{
+		// V1 = 0x81 and V2 = 0x06: in place, 0x81 is shifted; with Vy, 0x06 is.
+		{"legacy", []byte{0x81, 0x26}, 0x40, 1},
+		{"legacy", []byte{0x81, 0x2E}, 0x02, 1},
+		{"vip", []byte{0x81, 0x26}, 0x03, 0},
+		{"vip", []byte{0x81, 0x2E}, 0x0C, 0},
+		{"chip48", []byte{0x81, 0x26}, 0x40, 1},
+		{"schip", []byte{0x81, 0x2E}, 0x02, 1},
+		{"modern", []byte{0x81, 0x26}, 0x03, 0},
+		{"xochip", []byte{0x81, 0x2E}, 0x0C, 0},
+	}
+	for _, tt := range tests {
+		c := runProgram(t, QuirksPresets[tt.preset], tt.opcode, func(c *CPU) {
+			c.V[1], c.V[2] = 0x81, 0x06
+		})
+		if c.V[1] != tt.wantVX || c.V[0xF] != tt.wantVF {
+			t.Errorf("%s %X: V1 = %#02x, VF = %d, want %#02x, %d",
+				tt.preset, tt.opcode, c.V[1], c.V[0xF], tt.wantVX, tt.wantVF)
+		}
+	}
+}
+
+func TestQuirksLoadStoreIncrement(t *testing.T) {
+	tests := []struct {
+		preset string
+		wantI  uint16
+	}{
+		{"legacy", 0x300},
+		{"vip", 0x304},
+		{"chip48", 0x303},
+		{"schip", 0x300},
+		{"modern", 0x304},
+		{"xochip", 0x304},
+	}
+	for _, tt := range tests {
+		// F355 - LD [I], V3
+		c := runProgram(t, QuirksPresets[tt.preset], []byte{0xF3, 0x55}, func(c *CPU) {
+			c.I = 0x300
+			c.V = [16]uint8{1, 2, 3, 4, 5}
+		})
+		if c.I != tt.wantI {
+			t.Errorf("%s Fx55: I = %#x, want %#x", tt.preset, c.I, tt.wantI)
+		}
+		if got := c.Memory[0x300:0x305]; string(got) != string([]byte{1, 2, 3, 4, 0}) {
+			t.Errorf("%s Fx55: memory = %v, want [1 2 3 4 0]", tt.preset, got)
+		}
+
+		// F365 - LD V3, [I]
+		c = runProgram(t, QuirksPresets[tt.preset], []byte{0xF3, 0x65}, func(c *CPU) {
+			c.I = 0x300
+			copy(c.Memory[0x300:], []byte{6, 7, 8, 9, 10})
+		})
+		if c.I != tt.wantI {
+			t.Errorf("%s Fx65: I = %#x, want %#x", tt.preset, c.I, tt.wantI)
+		}
+		if got := c.V[:5]; string(got) != string([]byte{6, 7, 8, 9, 0}) {
+			t.Errorf("%s Fx65: V0-V4 = %v, want [6 7 8 9 0]", tt.preset, got)
+		}
+	}
+}
+
+func TestQuirksJump(t *testing.T) {
+	tests := []struct {
+		preset string
+		wantPC uint16
+	}{
+		{"legacy", 0x310},
+		{"vip", 0x310},
+		{"chip48", 0x320},
+		{"schip", 0x320},
+		{"modern", 0x310},
+		{"xochip", 0x310},
+	}
+	for _, tt := range tests {
+		// B300 - JP V0, 0x300, read as JP V3, 0x300 with JumpUsesVX
+		c := runProgram(t, QuirksPresets[tt.preset], []byte{0xB3, 0x00}, func(c *CPU) {
+			c.V[0], c.V[3] = 0x10, 0x20
+		})
+		if c.PC != tt.wantPC {
+			t.Errorf("%s Bnnn: PC = %#x, want %#x", tt.preset, c.PC, tt.wantPC)
+		}
+	}
+}
+
+func TestQuirksLogicVF(t *testing.T) {
+	tests := []struct {
+		preset string
+		wantVF uint8
+	}{
+		{"legacy", 0x7},
+		{"vip", 0},
+		{"chip48", 0x7},
+		{"schip", 0x7},
+		{"modern", 0x7},
+		{"xochip", 0x7},
+	}
+	for _, tt := range tests {
+		for _, opcode := range [][]byte{{0x81, 0x21}, {0x81, 0x22}, {0x81, 0x23}} {
+			c := runProgram(t, QuirksPresets[tt.preset], opcode, func(c *CPU) {
+				c.V[1], c.V[2], c.V[0xF] = 0x0C, 0x0A, 0x7
+			})
+			if c.V[0xF] != tt.wantVF {
+				t.Errorf("%s %X: VF = %d, want %d", tt.preset, opcode, c.V[0xF], tt.wantVF)
+			}
+		}
+	}
+}
+
+func TestQuirksSpriteClipping(t *testing.T) {
+	tests := []struct {
+		preset string
+		wrap   bool
+	}{
+		{"legacy", false},
+		{"vip", false},
+		{"chip48", false},
+		{"schip", false},
+		{"modern", true},
+		{"xochip", true},
+	}
+	for _, tt := range tests {
+		// D121 - DRW V1, V2, 1 with an 8 pixel wide row at x = 60, y = 31
+		// and D341 - DRW V3, V4, 1 at x = 60 + 64, y = 31 + 32, whose origin always wraps.
+		for _, opcode := range [][]byte{{0xD1, 0x21}, {0xD3, 0x41}} {
+			c := runProgram(t, QuirksPresets[tt.preset], opcode, func(c *CPU) {
+				c.V[1], c.V[2], c.V[3], c.V[4] = 60, 31, 124, 63
+				c.I = 0x300
+				c.Memory[0x300] = 0xFF
+			})
+			for x := uint8(60); x < 64; x++ {
+				if c.Display.GetPixel(x, 31) == 0 {
+					t.Errorf("%s %X: pixel %d, 31 is off", tt.preset, opcode, x)
+				}
+			}
+			for x := uint8(0); x < 4; x++ {
+				if on := c.Display.GetPixel(x, 31) != 0; on != tt.wrap {
+					t.Errorf("%s %X: pixel %d, 31 on = %v, want %v", tt.preset, opcode, x, on, tt.wrap)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package chip8
+
+import "time"
+
+// rewinder keeps the snapshots of the last frames so that the execution can be played backwards.
+//
+// Only the latest snapshot is kept whole. Every older frame is stored as the patches turning the frame
+// following it back into it, which are small since a frame changes little of the memory and the display.
+type rewinder struct {
+	current Snapshot
+	valid   bool
+
+	// frames is a ring buffer of count frames starting at start, the oldest first.
+	frames []rewindFrame
+	start  int
+	count  int
+}
+
+type rewindFrame struct {
+	cpu        cpuChunk
+	memorySize int
+	memory     []patch
+	w, h       uint8
+	planes     uint8
+	display    []patch
+}
+
+// patch is a run of bytes to copy at offset.
+type patch struct {
+	offset int
+	data   []byte
+}
+
+func newRewinder(frames int) *rewinder {
+	return &rewinder{frames: make([]rewindFrame, frames)}
+}
+
+// record adds s as the latest frame. The oldest frame is dropped when the buffer is full.
+func (r *rewinder) record(s Snapshot) {
+	if r.valid && len(r.frames) > 0 {
+		frame := rewindFrame{
+			cpu:        r.current.cpu,
+			memorySize: len(r.current.memory),
+			memory:     diff(s.memory, r.current.memory),
+			w:          r.current.display.W,
+			h:          r.current.display.H,
+			planes:     r.current.display.Planes,
+			display:    diff(s.display.Data[:], r.current.display.Data[:]),
+		}
+		end := (r.start + r.count) % len(r.frames)
+		r.frames[end] = frame
+		if r.count < len(r.frames) {
+			r.count++
+		} else {
+			r.start = (r.start + 1) % len(r.frames)
+		}
+	}
+	r.current = s
+	r.valid = true
+}
+
+// rewind drops the latest frame and returns the one before it.
+// It returns false when there are no frames left.
+func (r *rewinder) rewind() (Snapshot, bool) {
+	if r.count == 0 {
+		return Snapshot{}, false
+	}
+	r.count--
+	frame := r.frames[(r.start+r.count)%len(r.frames)]
+	r.frames[(r.start+r.count)%len(r.frames)] = rewindFrame{}
+
+	prev := Snapshot{
+		cpu:     frame.cpu,
+		memory:  make([]uint8, frame.memorySize),
+		display: r.current.display,
+	}
+	copy(prev.memory, r.current.memory)
+	apply(prev.memory, frame.memory)
+	prev.display.W = frame.w
+	prev.display.H = frame.h
+	prev.display.Planes = frame.planes
+	apply(prev.display.Data[:], frame.display)
+	r.current = prev
+	return prev, true
+}
+
+// diff returns the patches turning from into to. Both must have the same length, otherwise
+// to is returned whole.
+func diff(from, to []byte) []patch {
+	if len(from) != len(to) {
+		return []patch{{offset: 0, data: append([]byte(nil), to...)}}
+	}
+	var patches []patch
+	for i := 0; i < len(from); i++ {
+		if from[i] == to[i] {
+			continue
+		}
+		start := i
+		for i < len(from) && from[i] != to[i] {
+			i++
+		}
+		patches = append(patches, patch{offset: start, data: append([]byte(nil), to[start:i]...)})
+	}
+	return patches
+}
+
+func apply(b []byte, patches []patch) {
+	for _, p := range patches {
+		copy(b[p.offset:], p.data)
+	}
+}
+
+// EnableRewind keeps the frames run by Start during the last window so that they can be played backwards
+// with SetRewinding. A window of 0 disables rewinding.
+func (c *CPU) EnableRewind(window time.Duration) {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	frames := int(window.Seconds() * timerFrequency)
+	if frames <= 0 {
+		c.rewinder = nil
+		return
+	}
+	c.rewinder = newRewinder(frames)
+}
+
+// SetRewinding makes Start play the recorded frames backwards, one per tick of the 60Hz timer,
+// instead of executing instructions.
+func (c *CPU) SetRewinding(enabled bool) {
+	c.control.Lock()
+	defer c.control.Unlock()
+	c.control.rewinding = enabled
+}
+
+// Rewinding reports whether Start plays the frames backwards.
+func (c *CPU) Rewinding() bool {
+	c.control.Lock()
+	defer c.control.Unlock()
+	return c.control.rewinding
+}
+
+// rewindFrame restores the previous recorded frame.
+func (c *CPU) rewindFrame() {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	if c.rewinder == nil {
+		return
+	}
+	if s, ok := c.rewinder.rewind(); ok {
+		c.restore(s)
+	}
+}
+
+// recordFrame records the current frame for rewinding.
+func (c *CPU) recordFrame() {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	if c.rewinder == nil {
+		return
+	}
+	c.rewinder.record(c.snapshot())
+}
@@ -0,0 +1,213 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// A save state starts with a header made of the magic bytes, the version of the format and the length of
+// the payload, followed by the payload and the CRC-32 of the payload.
+//
+// The payload is a sequence of chunks, each made of a 4 bytes tag, the length of its data and the data.
+// Loading skips the chunks it does not know and pads the data of a chunk shorter than expected with zeroes,
+// so fields can be appended to a chunk without breaking the states saved before. The version only has to
+// be increased when the layout of an existing field changes.
+const (
+	stateMagic   = "CH8S"
+	stateVersion = 1
+)
+
+var (
+	tagCPU     = [4]byte{'C', 'P', 'U', ' '}
+	tagMemory  = [4]byte{'M', 'E', 'M', ' '}
+	tagDisplay = [4]byte{'D', 'I', 'S', 'P'}
+	tagKeys    = [4]byte{'K', 'E', 'Y', 'S'}
+	tagQuirks  = [4]byte{'Q', 'R', 'K', 'S'}
+)
+
+var (
+	// ErrInvalidState is returned when loading data which is not a save state.
+	ErrInvalidState = errors.New("invalid save state")
+	// ErrStateChecksum is returned when loading a corrupted save state.
+	ErrStateChecksum = errors.New("save state checksum mismatch")
+)
+
+// maxStateLength is the length of the largest payload: the chunks of the CPU, the extended memory, the
+// display, the keys and the quirks, each with its tag and length.
+var maxStateLength = 5*8 + binary.Size(cpuChunk{}) + extendedMemorySize + binary.Size(displayChunk{}) +
+	binary.Size([16]bool{}) + binary.Size(Quirks{})
+
+type stateHeader struct {
+	Magic   [4]byte
+	Version uint16
+	Length  uint32
+}
+
+type cpuChunk struct {
+	V          [16]uint8
+	I          uint16
+	PC         uint16
+	SP         uint8
+	Stack      [16]uint16
+	DT         uint8
+	ST         uint8
+	Hires      bool
+	Halted     bool
+	WaitingKey bool
+	RPL        [16]uint8
+	Pattern    [16]uint8
+	HasPattern bool
+	Pitch      uint8
+	// HasPitch is false in the states saved before the pitch was stored, which are loaded with
+	// the default pitch.
+	HasPitch bool
+}
+
+type displayChunk struct {
+	W, H   uint8
+	Planes uint8
+	Data   [displayWidth * displayHeight]uint8
+}
+
+// SaveState writes the state of the whole machine to w.
+// It can be called while Start runs; the state is then taken between two frames.
+func (c *CPU) SaveState(w io.Writer) error {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+
+	snapshot := c.snapshot()
+	var payload bytes.Buffer
+	chunks := []struct {
+		tag  [4]byte
+		data interface{}
+	}{
+		{tagCPU, snapshot.cpu},
+		{tagMemory, snapshot.memory},
+		{tagDisplay, snapshot.display},
+		{tagKeys, c.Keyboard.State()},
+		{tagQuirks, c.Quirks},
+	}
+	for _, chunk := range chunks {
+		if err := writeChunk(&payload, chunk.tag, chunk.data); err != nil {
+			return err
+		}
+	}
+
+	header := stateHeader{Version: stateVersion, Length: uint32(payload.Len())}
+	copy(header.Magic[:], stateMagic)
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload.Bytes()); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, crc32.ChecksumIEEE(payload.Bytes()))
+}
+
+// LoadState restores the state of the whole machine written by SaveState.
+// It can be called while Start runs; the state is then restored between two frames.
+func (c *CPU) LoadState(r io.Reader) error {
+	var header stateHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	if string(header.Magic[:]) != stateMagic {
+		return ErrInvalidState
+	}
+	if header.Version > stateVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidState, header.Version)
+	}
+	if header.Length > uint32(maxStateLength) {
+		return fmt.Errorf("%w: payload of %d bytes", ErrInvalidState, header.Length)
+	}
+	payload := make([]byte, header.Length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	var checksum uint32
+	if err := binary.Read(r, binary.LittleEndian, &checksum); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	if checksum != crc32.ChecksumIEEE(payload) {
+		return ErrStateChecksum
+	}
+
+	var (
+		snapshot Snapshot
+		keys     [16]bool
+		quirks   = c.Quirks
+	)
+	for len(payload) > 0 {
+		if len(payload) < 8 {
+			return ErrInvalidState
+		}
+		var tag [4]byte
+		copy(tag[:], payload)
+		length := binary.LittleEndian.Uint32(payload[4:])
+		payload = payload[8:]
+		if uint32(len(payload)) < length {
+			return ErrInvalidState
+		}
+		data := payload[:length]
+		payload = payload[length:]
+
+		var err error
+		switch tag {
+		case tagCPU:
+			err = readChunk(data, &snapshot.cpu)
+		case tagMemory:
+			snapshot.memory = append([]uint8(nil), data...)
+		case tagDisplay:
+			err = readChunk(data, &snapshot.display)
+		case tagKeys:
+			err = readChunk(data, &keys)
+		case tagQuirks:
+			err = readChunk(data, &quirks)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+	}
+	if n := len(snapshot.memory); n != memorySize && n != extendedMemorySize {
+		return fmt.Errorf("%w: memory of %d bytes", ErrInvalidState, n)
+	}
+	switch d := snapshot.display; {
+	case d.W == loresWidth && d.H == loresHeight, d.W == displayWidth && d.H == displayHeight:
+	default:
+		return fmt.Errorf("%w: display of %dx%d pixels", ErrInvalidState, d.W, d.H)
+	}
+	if sp := snapshot.cpu.SP; int(sp) > len(snapshot.cpu.Stack) {
+		return fmt.Errorf("%w: stack pointer %d", ErrInvalidState, sp)
+	}
+
+	c.exec.Lock()
+	defer c.exec.Unlock()
+
+	c.restore(snapshot)
+	c.Quirks = quirks
+	c.Keyboard.SetState(keys)
+	return nil
+}
+
+func writeChunk(w io.Writer, tag [4]byte, data interface{}) error {
+	if _, err := w.Write(tag[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(binary.Size(data))); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, data)
+}
+
+// readChunk decodes data into v, padding it with zeroes when it was written by an older version
+// of v with fewer fields.
+func readChunk(data []byte, v interface{}) error {
+	if size := binary.Size(v); len(data) < size {
+		data = append(append([]byte(nil), data...), make([]byte, size-len(data))...)
+	}
+	return binary.Read(bytes.NewReader(data), binary.LittleEndian, v)
+}
@@ -0,0 +1,86 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func saveState(t *testing.T, c *CPU) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := c.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	c := runProgram(t, QuirksLegacy, []byte{0x00, 0xFF, 0x63, 0x04, 0xA3, 0x00, 0xD0, 0x05, 0x22, 0x10}, nil)
+	data := saveState(t, c)
+
+	loaded := NewHeadlessCPU(QuirksModern)
+	if err := loaded.LoadState(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.snapshot(), c.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v, want %+v", got.cpu, want.cpu)
+	}
+	if loaded.Quirks != QuirksLegacy {
+		t.Errorf("loaded quirks %+v, want %+v", loaded.Quirks, QuirksLegacy)
+	}
+}
+
+func TestLoadStateInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(c *CPU)
+	}{
+		{"display height", func(c *CPU) { c.Display.H = 255 }},
+		{"display size", func(c *CPU) { c.Display.W, c.Display.H = displayWidth, loresHeight }},
+		{"stack pointer", func(c *CPU) { c.SP = 40 }},
+	}
+	for _, tt := range tests {
+		c := NewHeadlessCPU(QuirksLegacy)
+		tt.setup(c)
+		data := saveState(t, c)
+
+		loaded := NewHeadlessCPU(QuirksLegacy)
+		if err := loaded.LoadState(bytes.NewReader(data)); !errors.Is(err, ErrInvalidState) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, ErrInvalidState)
+		}
+		if got, want := loaded.snapshot(), NewHeadlessCPU(QuirksLegacy).snapshot(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: the state changed", tt.name)
+		}
+	}
+}
+
+func TestLoadStateLength(t *testing.T) {
+	header := stateHeader{Version: stateVersion, Length: 0xFFFFFFFF}
+	copy(header.Magic[:], stateMagic)
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		t.Fatal(err)
+	}
+	c := NewHeadlessCPU(QuirksLegacy)
+	if err := c.LoadState(&buf); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("error %v, want %v", err, ErrInvalidState)
+	}
+
+	// The largest state, with the extended memory, is within the limit.
+	c = NewHeadlessCPU(QuirksXOChip)
+	if err := c.LoadState(bytes.NewReader(saveState(t, c))); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadStateChecksum(t *testing.T) {
+	data := saveState(t, NewHeadlessCPU(QuirksLegacy))
+	data[len(data)/2] ^= 0xFF
+	c := NewHeadlessCPU(QuirksLegacy)
+	if err := c.LoadState(bytes.NewReader(data)); !errors.Is(err, ErrStateChecksum) {
+		t.Errorf("error %v, want %v", err, ErrStateChecksum)
+	}
+}
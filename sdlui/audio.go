@@ -0,0 +1,101 @@
+package sdlui
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/imrenagi/chip8"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// audioQueued is the number of samples kept queued on the SDL audio device, about 46ms. The latency of the
+// buzzer is up to that much.
+const audioQueued = 2048
+
+// AudioSink plays the buzzer on the default output device with SDL, feeding it the samples of the tone
+// from a goroutine.
+type AudioSink struct {
+	*chip8.Tone
+	device sdl.AudioDeviceID
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewAudioSink initializes the audio subsystem of SDL and opens the default output device.
+func NewAudioSink(config chip8.ToneConfig) (*AudioSink, error) {
+	tone, err := chip8.NewTone(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := sdl.InitSubSystem(sdl.INIT_AUDIO); err != nil {
+		return nil, err
+	}
+	spec := &sdl.AudioSpec{Freq: chip8.SampleRate, Format: sdl.AUDIO_F32, Channels: 1, Samples: 512}
+	device, err := sdl.OpenAudioDevice("", false, spec, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	s := &AudioSink{Tone: tone, device: device, done: make(chan struct{})}
+	sdl.PauseAudioDevice(device, false)
+	s.wg.Add(1)
+	go s.feed()
+	return s, nil
+}
+
+// feed keeps the device queue filled until the sink is closed.
+func (s *AudioSink) feed() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	samples := make([]float32, audioQueued)
+	buf := make([]byte, 4*audioQueued)
+	for {
+		queued := int(sdl.GetQueuedAudioSize(s.device)) / 4
+		if n := audioQueued - queued; n > 0 {
+			s.Generate(samples[:n])
+			for i, sample := range samples[:n] {
+				binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(sample))
+			}
+			if err := sdl.QueueAudio(s.device, buf[:4*n]); err != nil {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+				return
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// failure returns the error which stopped feeding the device, if any.
+func (s *AudioSink) failure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *AudioSink) Start() error {
+	s.SetOn(true)
+	return s.failure()
+}
+
+func (s *AudioSink) Stop() error {
+	s.SetOn(false)
+	return s.failure()
+}
+
+func (s *AudioSink) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	sdl.CloseAudioDevice(s.device)
+	return s.failure()
+}
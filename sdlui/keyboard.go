@@ -0,0 +1,9 @@
+package sdlui
+
+import "github.com/veandco/go-sdl2/sdl"
+
+// KeyName returns the name of the key of the window with scancode, as bound in a chip8.Keymap, e.g. "X" or
+// "Up". The scancodes are the positions of the keys, named after a QWERTY keyboard.
+func KeyName(scancode sdl.Scancode) string {
+	return sdl.GetScancodeName(scancode)
+}
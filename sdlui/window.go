@@ -0,0 +1,94 @@
+// Package sdlui is the SDL frontend of the emulator: it draws the display in a window, translates the keys
+// of the window to the keypad and plays the buzzer on the default output device.
+package sdlui
+
+import (
+	"sync"
+
+	"github.com/imrenagi/chip8"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Title is the title of the windows.
+const Title = "chip-8 emulator"
+
+// NewDisplay returns a Display drawn in a Window. SDL must have been initialized.
+func NewDisplay() chip8.Display {
+	return chip8.NewDisplay(NewWindow())
+}
+
+// NewWindow opens a 1280x640 window, where every pixel of the 128x64 screen is drawn 10 pixels wide.
+func NewWindow() *Window {
+	window, err := sdl.CreateWindow(Title,
+		sdl.WINDOWPOS_UNDEFINED,
+		sdl.WINDOWPOS_UNDEFINED,
+		1280, 640, sdl.WINDOW_SHOWN)
+	if err != nil {
+		panic(err)
+	}
+
+	surface, err := window.GetSurface()
+	if err != nil {
+		panic(err)
+	}
+	surface.FillRect(nil, 0)
+
+	return &Window{
+		window:  window,
+		surface: surface,
+	}
+}
+
+// palette are the colors of a pixel, indexed by the bitmask of the planes it is set in, as in
+// chip8.DefaultPalette.
+var palette = [4]uint32{0xff000000, 0xffff0000, 0xff00ff00, 0xffffff00}
+
+// Window is a Drawer showing the display in an SDL window.
+type Window struct {
+	sync.Mutex
+	window  *sdl.Window
+	surface *sdl.Surface
+}
+
+func (s *Window) Clear() {
+	s.surface.FillRect(nil, 0)
+}
+
+func (s *Window) SetPixel(x, y int, color uint8) {
+	rect := sdl.Rect{X: int32(x) * 10, Y: int32(y) * 10, W: 10, H: 10}
+	s.surface.FillRect(&rect, palette[color&0x3])
+}
+
+func (s *Window) Draw() {
+	s.window.UpdateSurface()
+}
+
+// Stop closes the window and quits SDL.
+func (s *Window) Stop() {
+	s.window.Destroy()
+	sdl.Quit()
+}
+
+// ShowKey replaces the display with the big digit of the key of the keypad, e.g. to ask for the host key
+// bound to it, and sets the title of the window to title. The display shows again with the next frame.
+func (s *Window) ShowKey(key uint8, title string) {
+	s.window.SetTitle(title)
+	s.surface.FillRect(nil, palette[0])
+	// The 8x10 digit is drawn 40 pixels per dot, centered in the 1280x640 window.
+	const dot = 40
+	x0, y0 := (1280-8*dot)/2, (640-10*dot)/2
+	for y, row := range chip8.Glyph(key) {
+		for x := 0; x < 8; x++ {
+			if row&(0x80>>x) != 0 {
+				rect := sdl.Rect{X: int32(x0 + x*dot), Y: int32(y0 + y*dot), W: dot, H: dot}
+				s.surface.FillRect(&rect, palette[1])
+			}
+		}
+	}
+	s.window.UpdateSurface()
+}
+
+// SetTitle sets the title of the window.
+func (s *Window) SetTitle(title string) {
+	s.window.SetTitle(title)
+}
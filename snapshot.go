@@ -0,0 +1,82 @@
+package chip8
+
+// Snapshot is the state of the CPU and the Display at one point in time.
+// It is kept in memory, see SaveState to store the state of the machine.
+type Snapshot struct {
+	cpu     cpuChunk
+	memory  []uint8
+	display displayChunk
+}
+
+// Snapshot returns the current state of the CPU and the Display.
+// It can be called while Start runs; the state is then taken between two frames.
+func (c *CPU) Snapshot() Snapshot {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	return c.snapshot()
+}
+
+// Restore brings the CPU and the Display back to the state of s.
+// It can be called while Start runs; the state is then restored between two frames.
+func (c *CPU) Restore(s Snapshot) {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+	c.restore(s)
+}
+
+func (c *CPU) snapshot() Snapshot {
+	return Snapshot{
+		cpu: cpuChunk{
+			V:          c.V,
+			I:          c.I,
+			PC:         c.PC,
+			SP:         c.SP,
+			Stack:      c.Stack,
+			DT:         c.DT,
+			ST:         c.ST,
+			Hires:      c.Hires,
+			Halted:     c.halted.Load(),
+			WaitingKey: c.waitingKey,
+			RPL:        c.RPL,
+			Pattern:    c.pattern,
+			HasPattern: c.hasPattern,
+			Pitch:      c.pitch,
+			HasPitch:   true,
+		},
+		memory: append([]uint8(nil), c.Memory...),
+		display: displayChunk{
+			W:      c.Display.W,
+			H:      c.Display.H,
+			Planes: c.Display.planes,
+			Data:   c.Display.data,
+		},
+	}
+}
+
+func (c *CPU) restore(s Snapshot) {
+	c.V = s.cpu.V
+	c.I = s.cpu.I
+	c.PC = s.cpu.PC
+	c.SP = s.cpu.SP
+	c.Stack = s.cpu.Stack
+	c.DT = s.cpu.DT
+	c.ST = s.cpu.ST
+	c.Hires = s.cpu.Hires
+	c.halted.Store(s.cpu.Halted)
+	c.waitingKey = s.cpu.WaitingKey
+	c.RPL = s.cpu.RPL
+	c.pattern = s.cpu.Pattern
+	c.hasPattern = s.cpu.HasPattern
+	c.pitch = s.cpu.Pitch
+	if !s.cpu.HasPitch {
+		c.pitch = defaultPitch
+	}
+	c.replayAudio()
+	c.Memory = append(c.Memory[:0], s.memory...)
+
+	c.Display.W = s.display.W
+	c.Display.H = s.display.H
+	c.Display.planes = s.display.Planes
+	c.Display.data = s.display.Data
+	c.Display.Draw()
+}
@@ -0,0 +1,166 @@
+// Package terminal is the terminal frontend of the emulator: it draws the display with the characters of an
+// ANSI terminal and presses the keys of the keypad typed in it, so that ROMs can be played over SSH.
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// screenWidth and screenHeight are the size of the SUPER-CHIP high resolution screen, in which the
+	// chip8.Display sets the pixels.
+	screenWidth  = 128
+	screenHeight = 64
+)
+
+// Mode is how a Drawer packs the pixels of the screen into the characters of the terminal.
+type Mode int
+
+const (
+	// HalfBlocks draws two pixels, one above the other, per character with the upper half block and the
+	// foreground and background colors: the 128x64 screen takes 128 columns and 32 rows.
+	HalfBlocks Mode = iota
+	// Braille draws a 2x4 block of pixels per character with the braille patterns: the screen takes 64
+	// columns and 16 rows, and the pixels of a character share its color.
+	Braille
+)
+
+// Modes are the terminal modes by name, as given on the command line.
+var Modes = map[string]Mode{
+	"halfblock": HalfBlocks,
+	"braille":   Braille,
+}
+
+// ansiColors are the ANSI colors of the pixels, indexed by the bitmask of their planes like the
+// chip8.DefaultPalette: black, red, green and yellow.
+var ansiColors = [4]int{0, 1, 2, 3}
+
+// cell is a character of the terminal. The zero cell is never drawn, so that it stands for unknown content.
+type cell struct {
+	char   rune
+	fg, bg uint8
+}
+
+// Drawer is a chip8.Drawer rendering the display in an ANSI terminal, e.g. over SSH. Only the characters
+// which changed since the last frame are written.
+type Drawer struct {
+	mu      sync.Mutex
+	w       *bufio.Writer
+	mode    Mode
+	back    [screenWidth * screenHeight]uint8
+	front   []cell
+	cols    int
+	rows    int
+	started bool
+	stopped bool
+}
+
+// NewDrawer returns a Drawer writing to w, which should be a terminal, in mode. The screen
+// is cleared and the cursor hidden on the first frame, until Stop.
+func NewDrawer(w io.Writer, mode Mode) *Drawer {
+	t := &Drawer{w: bufio.NewWriter(w), mode: mode}
+	switch mode {
+	case Braille:
+		t.cols, t.rows = screenWidth/2, screenHeight/4
+	default:
+		t.cols, t.rows = screenWidth, screenHeight/2
+	}
+	t.front = make([]cell, t.cols*t.rows)
+	return t
+}
+
+func (t *Drawer) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.back = [screenWidth * screenHeight]uint8{}
+}
+
+func (t *Drawer) SetPixel(x, y int, color uint8) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.back[y*screenWidth+x] = color
+}
+
+// Draw writes the characters which changed since the last frame.
+func (t *Drawer) Draw() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	if !t.started {
+		// Hide the cursor and clear the screen.
+		t.w.WriteString("\x1b[?25l\x1b[2J")
+		t.started = true
+	}
+	// x, y is the position of the cursor, and colors the colors set, -1 when they are unknown.
+	x, y := -1, -1
+	colors := cell{fg: 0xff, bg: 0xff}
+	for row := 0; row < t.rows; row++ {
+		for col := 0; col < t.cols; col++ {
+			c := t.cell(col, row)
+			if t.front[row*t.cols+col] == c {
+				continue
+			}
+			t.front[row*t.cols+col] = c
+			if x != col || y != row {
+				fmt.Fprintf(t.w, "\x1b[%d;%dH", row+1, col+1)
+			}
+			if c.fg != colors.fg || c.bg != colors.bg {
+				fmt.Fprintf(t.w, "\x1b[%d;%dm", 30+ansiColors[c.fg], 40+ansiColors[c.bg])
+				colors = c
+			}
+			t.w.WriteRune(c.char)
+			x, y = col+1, row
+		}
+	}
+	t.w.Flush()
+}
+
+// cell returns the character showing the pixels at col, row of the terminal.
+func (t *Drawer) cell(col, row int) cell {
+	pixel := func(x, y int) uint8 {
+		return t.back[y*screenWidth+x] & 0x3
+	}
+	if t.mode == HalfBlocks {
+		return cell{char: '▀', fg: pixel(col, 2*row), bg: pixel(col, 2*row+1)}
+	}
+
+	// The dots of the braille patterns are numbered down the left column, then down the right one, and
+	// the bottom row comes last.
+	dots := [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+	var counts [4]int
+	c := cell{char: 0x2800}
+	for dy := 0; dy < 4; dy++ {
+		for dx := 0; dx < 2; dx++ {
+			if p := pixel(2*col+dx, 4*row+dy); p != 0 {
+				c.char |= dots[dy][dx]
+				counts[p]++
+			}
+		}
+	}
+	// The character takes the color of most of its pixels.
+	for p := 1; p < len(counts); p++ {
+		if counts[p] > counts[c.fg] {
+			c.fg = uint8(p)
+		}
+	}
+	return c
+}
+
+// Stop restores the colors and the cursor, below the screen. Nothing is drawn after it.
+func (t *Drawer) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	t.stopped = true
+	if t.started {
+		fmt.Fprintf(t.w, "\x1b[0m\x1b[?25h\x1b[%d;1H\r\n", t.rows)
+		t.w.Flush()
+	}
+}
@@ -0,0 +1,73 @@
+package terminal
+
+import (
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/imrenagi/chip8"
+)
+
+// Keypad presses the keys of a chip8.Keyboard typed in a terminal. Terminals send the characters typed,
+// but not when the keys are released: a key is released when it has not been typed for hold, and the
+// auto-repeat of the terminal keeps it pressed while it is held, past its initial delay.
+type Keypad struct {
+	keyboard *chip8.Keyboard
+	keymap   chip8.Keymap
+	hold     time.Duration
+
+	mu   sync.Mutex
+	held map[uint8]*heldKey
+}
+
+// heldKey is a key pressed from the terminal, released at until.
+type heldKey struct {
+	until time.Time
+	timer *time.Timer
+}
+
+// NewKeypad returns a Keypad pressing the keys of keyboard bound in keymap for hold after
+// they are typed.
+func NewKeypad(keyboard *chip8.Keyboard, keymap chip8.Keymap, hold time.Duration) *Keypad {
+	return &Keypad{keyboard: keyboard, keymap: keymap, hold: hold, held: make(map[uint8]*heldKey)}
+}
+
+// Type presses the key of the keypad bound to the character r, and reports whether there is one. Unlike in
+// the SDL window, the characters are those of the layout of the keyboard, not the position of the keys.
+func (t *Keypad) Type(r rune) bool {
+	if r == ' ' {
+		return t.Press("Space")
+	}
+	return t.Press(string(unicode.ToUpper(r)))
+}
+
+// Press presses the key of the keypad bound to the host key name, e.g. "Up" for the escape sequence of the
+// arrow, and reports whether there is one.
+func (t *Keypad) Press(name string) bool {
+	key, ok := t.keymap.Key(name)
+	if !ok {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if k, ok := t.held[key]; ok {
+		// The key is repeated while it is held: it is released later.
+		k.until = time.Now().Add(t.hold)
+		return true
+	}
+	k := &heldKey{until: time.Now().Add(t.hold)}
+	k.timer = time.AfterFunc(t.hold, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if left := time.Until(k.until); left > 0 {
+			k.timer.Reset(left)
+			return
+		}
+		delete(t.held, key)
+		t.keyboard.Accept(chip8.NewKeyEvent(false, key))
+	})
+	t.held[key] = k
+	t.keyboard.Accept(chip8.NewKeyEvent(true, key))
+	return true
+}
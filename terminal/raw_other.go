@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package terminal
+
+import (
+	"errors"
+	"runtime"
+)
+
+// MakeRaw is not supported on this platform.
+func MakeRaw(fd int) (restore func() error, err error) {
+	return nil, errors.New("raw terminal input is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,63 @@
+package trace
+
+import "fmt"
+
+// Diff returns the differences between two records of the same step, one per line, or nil when they match.
+// The registers are compared by the values they had before and after the instruction; a register missing
+// from a record was not changed by its instruction.
+func Diff(a, b *Record) []string {
+	var diffs []string
+	if a.PC != b.PC {
+		diffs = append(diffs, fmt.Sprintf("PC: 0x%04X != 0x%04X", a.PC, b.PC))
+	}
+	if a.Opcode != b.Opcode || a.Long != b.Long {
+		diffs = append(diffs, fmt.Sprintf("opcode: %04X (%s) != %04X (%s)", a.Opcode, a.Disassembly, b.Opcode, b.Disassembly))
+	}
+
+	ra, rb := registers(a), registers(b)
+	for reg := V0; reg < Stack+16; reg++ {
+		ca, okA := ra[reg]
+		cb, okB := rb[reg]
+		switch {
+		case !okA && !okB:
+		case !okA:
+			diffs = append(diffs, fmt.Sprintf("%s: unchanged != 0x%X -> 0x%X", RegisterName(reg), cb.Before, cb.After))
+		case !okB:
+			diffs = append(diffs, fmt.Sprintf("%s: 0x%X -> 0x%X != unchanged", RegisterName(reg), ca.Before, ca.After))
+		case ca.Before != cb.Before || ca.After != cb.After:
+			diffs = append(diffs, fmt.Sprintf("%s: 0x%X -> 0x%X != 0x%X -> 0x%X", RegisterName(reg), ca.Before, ca.After, cb.Before, cb.After))
+		}
+	}
+
+	n := len(a.Memory)
+	if len(b.Memory) > n {
+		n = len(b.Memory)
+	}
+	for i := 0; i < n; i++ {
+		switch {
+		case i >= len(a.Memory):
+			m := b.Memory[i]
+			diffs = append(diffs, fmt.Sprintf("memory: no write != [0x%04X] 0x%02X -> 0x%02X", m.Addr, m.Before, m.After))
+		case i >= len(b.Memory):
+			m := a.Memory[i]
+			diffs = append(diffs, fmt.Sprintf("memory: [0x%04X] 0x%02X -> 0x%02X != no write", m.Addr, m.Before, m.After))
+		case a.Memory[i] != b.Memory[i]:
+			ma, mb := a.Memory[i], b.Memory[i]
+			diffs = append(diffs, fmt.Sprintf("memory: [0x%04X] 0x%02X -> 0x%02X != [0x%04X] 0x%02X -> 0x%02X",
+				ma.Addr, ma.Before, ma.After, mb.Addr, mb.Before, mb.After))
+		}
+	}
+
+	if a.Error != b.Error {
+		diffs = append(diffs, fmt.Sprintf("error: %q != %q", a.Error, b.Error))
+	}
+	return diffs
+}
+
+func registers(r *Record) map[int]Change {
+	m := make(map[int]Change, len(r.Registers))
+	for _, c := range r.Registers {
+		m[c.Register] = c
+	}
+	return m
+}
@@ -0,0 +1,251 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Format is the encoding of a trace.
+type Format int
+
+const (
+	// JSONLines writes a Record per line, as JSON.
+	JSONLines Format = iota
+	// Binary writes the records packed in a few bytes each, after the "CH8T" magic and a version byte.
+	// The disassembly is not stored: it is decoded again when reading.
+	Binary
+)
+
+// Formats are the formats by name, as given on the command line.
+var Formats = map[string]Format{
+	"jsonl":  JSONLines,
+	"binary": Binary,
+}
+
+var magic = []byte("CH8T")
+
+const binaryVersion = 1
+
+// maxErrorLength bounds the length of the error of a binary record, so that a corrupt length is not
+// allocated. The errors of the CPU are far shorter.
+const maxErrorLength = 4096
+
+// The flags starting each record of the binary format.
+const (
+	flagLong = 1 << iota
+	flagError
+)
+
+// Writer writes the records of a trace. Flush must be called once the trace is complete.
+type Writer struct {
+	w      *bufio.Writer
+	format Format
+	header bool
+}
+
+// NewWriter returns a Writer writing the trace to w in format.
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{w: bufio.NewWriter(w), format: format}
+}
+
+// Write writes a record.
+func (w *Writer) Write(r *Record) error {
+	if w.format == JSONLines {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		w.w.Write(b)
+		return w.w.WriteByte('\n')
+	}
+
+	if !w.header {
+		w.w.Write(magic)
+		w.w.WriteByte(binaryVersion)
+		w.header = true
+	}
+	var flags byte
+	if r.Opcode == 0xF000 {
+		flags |= flagLong
+	}
+	if r.Error != "" {
+		flags |= flagError
+	}
+	b := []byte{flags}
+	b = binary.AppendUvarint(b, r.Step)
+	b = binary.BigEndian.AppendUint16(b, r.PC)
+	b = binary.BigEndian.AppendUint16(b, r.Opcode)
+	if flags&flagLong != 0 {
+		b = binary.BigEndian.AppendUint16(b, r.Long)
+	}
+	b = append(b, byte(len(r.Registers)))
+	for _, c := range r.Registers {
+		b = append(b, byte(c.Register))
+		b = binary.BigEndian.AppendUint16(b, c.Before)
+		b = binary.BigEndian.AppendUint16(b, c.After)
+	}
+	b = binary.AppendUvarint(b, uint64(len(r.Memory)))
+	for _, m := range r.Memory {
+		b = binary.BigEndian.AppendUint16(b, m.Addr)
+		b = append(b, m.Before, m.After)
+	}
+	if flags&flagError != 0 {
+		b = binary.AppendUvarint(b, uint64(len(r.Error)))
+		b = append(b, r.Error...)
+	}
+	_, err := w.w.Write(b)
+	return err
+}
+
+// Flush writes the buffered records.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Reader reads the records of a trace in either format.
+type Reader struct {
+	r      *bufio.Reader
+	format Format
+	line   int
+}
+
+// NewReader returns a Reader reading the trace from r. The format is recognized from the first bytes.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(magic) + 1)
+	if err == nil && bytes.Equal(head[:len(magic)], magic) {
+		if head[len(magic)] != binaryVersion {
+			return nil, fmt.Errorf("unsupported trace version %d", head[len(magic)])
+		}
+		br.Discard(len(head))
+		return &Reader{r: br, format: Binary}, nil
+	}
+	return &Reader{r: br, format: JSONLines}, nil
+}
+
+// Read returns the next record, or io.EOF at the end of the trace.
+func (r *Reader) Read() (*Record, error) {
+	if r.format == JSONLines {
+		return r.readJSON()
+	}
+	rec, err := r.readBinary()
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, errors.New("truncated trace")
+	}
+	return rec, err
+}
+
+func (r *Reader) readJSON() (*Record, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			r.line++
+			continue
+		}
+		r.line++
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		for i, c := range rec.Registers {
+			reg, ok := register(c.Name)
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown register %q", r.line, c.Name)
+			}
+			rec.Registers[i].Register = reg
+		}
+		return &rec, nil
+	}
+}
+
+func (r *Reader) readBinary() (*Record, error) {
+	flags, err := r.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	var rec Record
+	if rec.Step, err = binary.ReadUvarint(r.r); err != nil {
+		return nil, unexpected(err)
+	}
+	if rec.PC, err = r.uint16(); err != nil {
+		return nil, err
+	}
+	if rec.Opcode, err = r.uint16(); err != nil {
+		return nil, err
+	}
+	if flags&flagLong != 0 {
+		if rec.Long, err = r.uint16(); err != nil {
+			return nil, err
+		}
+	}
+	rec.Disassembly = disassemble(rec.PC, rec.Opcode, rec.Long)
+
+	n, err := r.r.ReadByte()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	for i := 0; i < int(n); i++ {
+		var b [5]byte
+		if _, err := io.ReadFull(r.r, b[:]); err != nil {
+			return nil, unexpected(err)
+		}
+		rec.Registers = append(rec.Registers, Change{
+			Register: int(b[0]),
+			Name:     RegisterName(int(b[0])),
+			Before:   binary.BigEndian.Uint16(b[1:]),
+			After:    binary.BigEndian.Uint16(b[3:]),
+		})
+	}
+
+	count, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	for i := uint64(0); i < count; i++ {
+		var b [4]byte
+		if _, err := io.ReadFull(r.r, b[:]); err != nil {
+			return nil, unexpected(err)
+		}
+		rec.Memory = append(rec.Memory, MemoryChange{Addr: binary.BigEndian.Uint16(b[:]), Before: b[2], After: b[3]})
+	}
+
+	if flags&flagError != 0 {
+		length, err := binary.ReadUvarint(r.r)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if length > maxErrorLength {
+			return nil, fmt.Errorf("error of %d bytes", length)
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(r.r, msg); err != nil {
+			return nil, unexpected(err)
+		}
+		rec.Error = string(msg)
+	}
+	return &rec, nil
+}
+
+func (r *Reader) uint16() (uint16, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(r.r, b[:]); err != nil {
+		return 0, unexpected(err)
+	}
+	return binary.BigEndian.Uint16(b[:]), nil
+}
+
+// unexpected turns io.EOF into io.ErrUnexpectedEOF, since the record has started.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
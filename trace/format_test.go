@@ -0,0 +1,147 @@
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// testRecords covers the optional parts of a record: the long address, the register, stack and memory
+// changes and the error.
+func testRecords() []*Record {
+	records := []*Record{
+		{Step: 0, PC: 0x200, Opcode: 0x6304, Registers: []Change{{Register: V0 + 3, Name: "V3", Before: 0, After: 4}}},
+		{Step: 1, PC: 0x202, Opcode: 0xF000, Long: 0x1234, Registers: []Change{{Register: I, Name: "I", Before: 0, After: 0x1234}}},
+		{
+			Step: 2, PC: 0x206, Opcode: 0x2300,
+			Registers: []Change{
+				{Register: SP, Name: "SP", Before: 0, After: 1},
+				{Register: Stack, Name: "Stack[0]", Before: 0, After: 0x208},
+			},
+		},
+		{
+			Step: 300, PC: 0x300, Opcode: 0xF355,
+			Memory: []MemoryChange{{Addr: 0x1234, Before: 0, After: 4}, {Addr: 0x1235, Before: 7, After: 7}},
+		},
+		{Step: 301, PC: 0x302, Opcode: 0x00EE, Error: "stack underflow"},
+	}
+	for _, r := range records {
+		r.Disassembly = disassemble(r.PC, r.Opcode, r.Long)
+	}
+	return records
+}
+
+func encode(t *testing.T, format Format, records []*Record) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, format)
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readAll reads the records of data until the end of the trace or the first error.
+func readAll(data []byte) ([]*Record, error) {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var records []*Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	for name, format := range Formats {
+		want := testRecords()
+		got, err := readAll(encode(t, format, want))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: read %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestFormatTruncatedBinary(t *testing.T) {
+	records := testRecords()
+	data := encode(t, Binary, records)
+	// ends holds the length of the trace after each record.
+	ends := map[int]int{len(magic) + 1: 0}
+	for i := range records {
+		ends[len(encode(t, Binary, records[:i+1]))] = i + 1
+	}
+
+	for n := len(magic) + 1; n < len(data); n++ {
+		got, err := readAll(data[:n])
+		if count, ok := ends[n]; ok {
+			if err != nil || len(got) != count {
+				t.Errorf("%d bytes: read %d records, %v, want %d records", n, len(got), err, count)
+			}
+			continue
+		}
+		if err == nil || err.Error() != "truncated trace" {
+			t.Errorf("%d bytes: error %v, want truncated trace", n, err)
+		}
+		if want := append([]*Record(nil), records[:len(got)]...); !reflect.DeepEqual(got, want) {
+			t.Errorf("%d bytes: read %+v before the error", n, got)
+		}
+	}
+}
+
+func TestFormatCorruptErrorLength(t *testing.T) {
+	data := append(append([]byte(nil), magic...), binaryVersion, flagError)
+	// Step 0, PC, opcode, no register change, no memory change and an error of 2^63+1 bytes.
+	data = append(data, 0, 0x02, 0x00, 0x00, 0xE0, 0, 0)
+	data = append(data, 0x81, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01)
+	got, err := readAll(data)
+	if err == nil || len(got) != 0 {
+		t.Errorf("read %d records, %v, want an error", len(got), err)
+	}
+}
+
+func TestFormatTruncatedJSONLines(t *testing.T) {
+	records := testRecords()
+	data := encode(t, JSONLines, records)
+	// Cut the last record in its middle.
+	cut := len(encode(t, JSONLines, records[:len(records)-1])) + 10
+
+	got, err := readAll(data[:cut])
+	if err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("error %v, want the last line to be invalid", err)
+	}
+	if !reflect.DeepEqual(got, records[:len(records)-1]) {
+		t.Errorf("read %+v before the error", got)
+	}
+
+	// The records end with a new line, so only the last one is lost when the trace is cut after it.
+	got, err = readAll(data[:len(data)-1])
+	if err != nil || len(got) != len(records) {
+		t.Errorf("without the last new line: read %d records, %v, want %d", len(got), err, len(records))
+	}
+}
+
+func TestFormatUnsupportedVersion(t *testing.T) {
+	data := append(append([]byte(nil), magic...), binaryVersion+1)
+	if _, err := NewReader(bytes.NewReader(data)); err == nil {
+		t.Error("read a trace of an unsupported version")
+	}
+}
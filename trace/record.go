@@ -0,0 +1,107 @@
+// Package trace records the instructions executed by the CPU along with the state they changed, so that
+// two runs of a program, e.g. on this emulator and on a reference interpreter, can be compared.
+//
+// The traces are written as JSON Lines, one Record per line, or in a compact binary format holding the
+// same information. Reader reads both.
+package trace
+
+import (
+	"fmt"
+
+	"github.com/imrenagi/chip8/disasm"
+)
+
+// The registers of a Change. The stack entries follow: Stack + n is Stack[n].
+const (
+	V0    = 0
+	I     = 16
+	SP    = 17
+	DT    = 18
+	ST    = 19
+	Stack = 20
+)
+
+// Record is an executed instruction.
+type Record struct {
+	// Step is the index of the instruction in the trace, starting from 0.
+	Step uint64 `json:"step"`
+	PC   uint16 `json:"pc"`
+	// Opcode is the instruction, and Long the address following the F000 nnnn instruction.
+	Opcode uint16 `json:"opcode"`
+	Long   uint16 `json:"long,omitempty"`
+	// Disassembly is the instruction in the Cowgod notation, e.g. "LD V3, #04".
+	Disassembly string `json:"disasm"`
+	// Registers are the registers changed by the instruction, besides PC.
+	Registers []Change `json:"registers,omitempty"`
+	// Memory are the bytes written by the instruction, including those written with their own value.
+	Memory []MemoryChange `json:"memory,omitempty"`
+	// Error is the error the instruction failed with. PC is left at the failing instruction.
+	Error string `json:"error,omitempty"`
+}
+
+// Change is the change of a register, or of an entry of the stack.
+type Change struct {
+	Register int    `json:"-"`
+	Name     string `json:"reg"`
+	Before   uint16 `json:"before"`
+	After    uint16 `json:"after"`
+}
+
+// MemoryChange is a byte written to memory.
+type MemoryChange struct {
+	Addr   uint16 `json:"addr"`
+	Before uint8  `json:"before"`
+	After  uint8  `json:"after"`
+}
+
+// RegisterName returns the name of a register of a Change: V0 to VF, I, SP, DT, ST or Stack[n].
+func RegisterName(reg int) string {
+	switch {
+	case reg < I:
+		return fmt.Sprintf("V%X", reg)
+	case reg == I:
+		return "I"
+	case reg == SP:
+		return "SP"
+	case reg == DT:
+		return "DT"
+	case reg == ST:
+		return "ST"
+	}
+	return fmt.Sprintf("Stack[%d]", reg-Stack)
+}
+
+// register returns the register named name by RegisterName.
+func register(name string) (int, bool) {
+	for reg := V0; reg < Stack+16; reg++ {
+		if RegisterName(reg) == name {
+			return reg, true
+		}
+	}
+	return 0, false
+}
+
+// disassemble returns the Cowgod notation of an instruction, or "" when the opcode is invalid.
+func disassemble(pc, op, long uint16) string {
+	code := []byte{byte(op >> 8), byte(op), byte(long >> 8), byte(long)}
+	in, ok := disasm.Decode(code, pc, pc)
+	if !ok {
+		return ""
+	}
+	return in.String()
+}
+
+// String returns the record on a single line, e.g. "12 0x0206 8014 ADD V0, V1 V0=FF->0 VF=0->1".
+func (r *Record) String() string {
+	s := fmt.Sprintf("%d 0x%04X %04X %s", r.Step, r.PC, r.Opcode, r.Disassembly)
+	for _, c := range r.Registers {
+		s += fmt.Sprintf(" %s=%X->%X", c.Name, c.Before, c.After)
+	}
+	for _, m := range r.Memory {
+		s += fmt.Sprintf(" [0x%04X]=%02X->%02X", m.Addr, m.Before, m.After)
+	}
+	if r.Error != "" {
+		s += " error: " + r.Error
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package trace
+
+import (
+	"io"
+
+	"github.com/imrenagi/chip8"
+)
+
+// Source is a sequence of records, read until io.EOF. Reader and Run are sources.
+type Source interface {
+	Read() (*Record, error)
+}
+
+// Run is a Source executing a program: each Read executes an instruction and returns its record.
+// The timers tick every instructionsPerFrame instructions, so that the runs are repeatable.
+type Run struct {
+	cpu      *chip8.CPU
+	perFrame int
+	tracer   *Tracer
+	steps    int
+	last     *Record
+	done     bool
+}
+
+// NewRun returns a Run executing the program loaded into cpu.
+func NewRun(cpu *chip8.CPU, instructionsPerFrame int) *Run {
+	if instructionsPerFrame < 1 {
+		instructionsPerFrame = 1
+	}
+	r := &Run{cpu: cpu, perFrame: instructionsPerFrame}
+	r.tracer = New(cpu, recordFunc(func(rec *Record) error {
+		r.last = rec
+		return nil
+	}))
+	return r
+}
+
+type recordFunc func(r *Record) error
+
+func (f recordFunc) Write(r *Record) error {
+	return f(r)
+}
+
+// Read executes the next instruction. It returns io.EOF once the program exited or an instruction failed,
+// the record of the failing instruction holding the error.
+func (r *Run) Read() (*Record, error) {
+	if r.done || r.cpu.Halted() {
+		return nil, io.EOF
+	}
+	r.last = nil
+	err := r.cpu.Step()
+	r.steps++
+	if r.steps%r.perFrame == 0 {
+		r.cpu.TickTimers()
+	}
+	if err != nil {
+		r.done = true
+	}
+	if r.last == nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return r.last, nil
+}
+
+// CPU returns the CPU executing the program.
+func (r *Run) CPU() *chip8.CPU {
+	return r.cpu
+}
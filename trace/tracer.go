@@ -0,0 +1,178 @@
+package trace
+
+import (
+	"sync"
+
+	"github.com/imrenagi/chip8"
+)
+
+// state is the part of the CPU an instruction may change, besides the memory and PC.
+type state struct {
+	v      [16]uint8
+	i      uint16
+	sp     uint8
+	dt, st uint8
+	stack  [16]uint16
+}
+
+func capture(c *chip8.CPU) state {
+	return state{v: c.V, i: c.I, sp: c.SP, dt: c.DT, st: c.ST, stack: c.Stack}
+}
+
+// changes returns the registers which differ between the states before and after an instruction.
+func changes(before, after state) []Change {
+	var cs []Change
+	add := func(reg int, b, a uint16) {
+		if b != a {
+			cs = append(cs, Change{Register: reg, Name: RegisterName(reg), Before: b, After: a})
+		}
+	}
+	for x := range before.v {
+		add(V0+x, uint16(before.v[x]), uint16(after.v[x]))
+	}
+	add(I, before.i, after.i)
+	add(SP, uint16(before.sp), uint16(after.sp))
+	add(DT, uint16(before.dt), uint16(after.dt))
+	add(ST, uint16(before.st), uint16(after.st))
+	for n := range before.stack {
+		add(Stack+n, before.stack[n], after.stack[n])
+	}
+	return cs
+}
+
+// RecordWriter is written the records of a Tracer, e.g. a Writer.
+type RecordWriter interface {
+	Write(r *Record) error
+}
+
+// Tracer records the instructions executed by a CPU. It is set up with the hooks of the CPU, and calls the
+// hooks set before, so that it can trace a program being debugged.
+type Tracer struct {
+	cpu  *chip8.CPU
+	w    RecordWriter
+	prev chip8.Hooks
+
+	mu     sync.Mutex
+	step   uint64
+	record *Record
+	before state
+	err    error
+}
+
+// New returns a Tracer writing the instructions executed by cpu to w, from now on.
+func New(cpu *chip8.CPU, w RecordWriter) *Tracer {
+	t := &Tracer{cpu: cpu, w: w}
+	cpu.Exclusive(func() {
+		t.prev = cpu.Hooks
+		cpu.Hooks.BeforeStep = t.beforeStep
+		cpu.Hooks.AfterStep = t.afterStep
+		cpu.Hooks.Error = t.error
+		cpu.Hooks.MemoryWrite = t.memoryWrite
+	})
+	return t
+}
+
+// Close stops tracing, restoring the hooks of the CPU it replaced, and flushes the trace when w has a Flush
+// method. It returns the first error writing the trace.
+func (t *Tracer) Close() error {
+	t.cpu.Exclusive(func() {
+		t.cpu.Hooks.BeforeStep = t.prev.BeforeStep
+		t.cpu.Hooks.AfterStep = t.prev.AfterStep
+		t.cpu.Hooks.Error = t.prev.Error
+		t.cpu.Hooks.MemoryWrite = t.prev.MemoryWrite
+	})
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, ok := t.w.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil && t.err == nil {
+			t.err = err
+		}
+	}
+	return t.err
+}
+
+// Steps returns the number of instructions traced so far.
+func (t *Tracer) Steps() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.step
+}
+
+func (t *Tracer) beforeStep() error {
+	if t.prev.BeforeStep != nil {
+		// The instruction is not executed when the previous hook stops the execution.
+		if err := t.prev.BeforeStep(); err != nil {
+			return err
+		}
+	}
+	c := t.cpu
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.before = capture(c)
+	t.record = &Record{Step: t.step, PC: c.PC}
+	if int(c.PC)+1 < len(c.Memory) {
+		t.record.Opcode = uint16(c.Memory[c.PC])<<8 | uint16(c.Memory[c.PC+1])
+	}
+	if t.record.Opcode == 0xF000 && int(c.PC)+3 < len(c.Memory) {
+		t.record.Long = uint16(c.Memory[c.PC+2])<<8 | uint16(c.Memory[c.PC+3])
+	}
+	t.record.Disassembly = disassemble(t.record.PC, t.record.Opcode, t.record.Long)
+	return nil
+}
+
+func (t *Tracer) memoryWrite(addr int, val uint8) {
+	t.mu.Lock()
+	if t.record != nil {
+		// The hook is called before the byte is written, so the memory still holds its previous value.
+		t.record.Memory = append(t.record.Memory, MemoryChange{Addr: uint16(addr), Before: t.cpu.Memory[addr], After: val})
+	}
+	t.mu.Unlock()
+	if t.prev.MemoryWrite != nil {
+		t.prev.MemoryWrite(addr, val)
+	}
+}
+
+func (t *Tracer) afterStep() error {
+	if err := t.finish(func(r *Record) {
+		r.Registers = changes(t.before, capture(t.cpu))
+	}); err != nil {
+		return err
+	}
+	if t.prev.AfterStep != nil {
+		return t.prev.AfterStep()
+	}
+	return nil
+}
+
+func (t *Tracer) error(err error) error {
+	if werr := t.finish(func(r *Record) {
+		// The failing instruction may have changed the state before failing, and its changes are kept.
+		r.Registers = changes(t.before, capture(t.cpu))
+		r.Error = err.Error()
+	}); werr != nil {
+		return werr
+	}
+	if t.prev.Error != nil {
+		return t.prev.Error(err)
+	}
+	return err
+}
+
+// finish completes the record of the instruction with complete and writes it. A failure to write stops
+// the execution, since the trace would be incomplete.
+func (t *Tracer) finish(complete func(r *Record)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := t.record
+	t.record = nil
+	if r == nil || t.err != nil {
+		return t.err
+	}
+	complete(r)
+	t.step++
+	if err := t.w.Write(r); err != nil {
+		t.err = err
+		return err
+	}
+	return nil
+}
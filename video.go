@@ -0,0 +1,164 @@
+package chip8
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sync"
+)
+
+// VideoEncoder encodes the frames of a VideoRecorder.
+type VideoEncoder interface {
+	// WriteFrame encodes img, shown for the given number of ticks of the 60Hz timer.
+	WriteFrame(img *image.Paletted, ticks int) error
+	// Close completes the video.
+	Close() error
+}
+
+// VideoRecorder records the display of the CPU, one frame per tick of the 60Hz timer: the content of the
+// display at the tick. The frames which do not change are merged, so that the encoders can store them once.
+type VideoRecorder struct {
+	display *Display
+	scale   int
+	palette Palette
+	enc     VideoEncoder
+
+	mu      sync.Mutex
+	last    [displayWidth * displayHeight]uint8
+	lastW   uint8
+	pending int
+	frames  int
+	closed  bool
+	err     error
+}
+
+// NewVideoRecorder returns a VideoRecorder encoding display with enc, at scale with palette. Tick must then
+// be called at every tick of the timer, e.g. from Hooks.Tick.
+func NewVideoRecorder(display *Display, enc VideoEncoder, scale int, palette Palette) *VideoRecorder {
+	return &VideoRecorder{display: display, scale: scale, palette: palette, enc: enc}
+}
+
+// Frames returns the number of ticks recorded.
+func (r *VideoRecorder) Frames() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.frames + r.pending
+}
+
+// Tick records the display at the tick of the timer which just happened. It must be called while the
+// state of the CPU is locked, as Hooks.Tick is.
+func (r *VideoRecorder) Tick() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.err != nil {
+		return
+	}
+	d := r.display
+	if r.pending > 0 && d.W == r.lastW && d.data == r.last {
+		r.pending++
+		return
+	}
+	if r.err = r.flush(); r.err != nil {
+		return
+	}
+	r.last, r.lastW = d.data, d.W
+	r.pending = 1
+}
+
+// flush encodes the pending frame. r.mu must be held.
+func (r *VideoRecorder) flush() error {
+	if r.pending == 0 {
+		return nil
+	}
+	d := Display{W: r.lastW, H: r.lastW / 2, data: r.last}
+	img := d.Snapshot(r.scale, r.palette).(*image.Paletted)
+	if err := r.enc.WriteFrame(img, r.pending); err != nil {
+		return err
+	}
+	r.frames += r.pending
+	r.pending = 0
+	return nil
+}
+
+// Close encodes the last frame and completes the video. The ticks after it are not recorded. It returns
+// the first error encoding the video.
+func (r *VideoRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return r.err
+	}
+	r.closed = true
+	if r.err == nil {
+		r.err = r.flush()
+	}
+	if err := r.enc.Close(); r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// y4mEncoder encodes the frames as a raw YUV4MPEG2 stream at 60 frames per second, with 4:4:4 chroma.
+type y4mEncoder struct {
+	w      *bufio.Writer
+	closer io.Closer
+	header bool
+	buf    []byte
+}
+
+// NewY4MEncoder returns a VideoEncoder writing a raw YUV4MPEG2 video to w, which tools such as ffmpeg read.
+// Closing it closes w when it is an io.Closer.
+func NewY4MEncoder(w io.Writer) VideoEncoder {
+	e := &y4mEncoder{w: bufio.NewWriter(w)}
+	e.closer, _ = w.(io.Closer)
+	return e
+}
+
+func (e *y4mEncoder) WriteFrame(img *image.Paletted, ticks int) error {
+	size := img.Bounds().Size()
+	if !e.header {
+		fmt.Fprintf(e.w, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C444\n", size.X, size.Y, timerFrequency)
+		e.header = true
+	}
+
+	var ycbcr [3][]uint8
+	for _, c := range img.Palette {
+		r, g, b, _ := c.RGBA()
+		y, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+		ycbcr[0] = append(ycbcr[0], y)
+		ycbcr[1] = append(ycbcr[1], cb)
+		ycbcr[2] = append(ycbcr[2], cr)
+	}
+	n := size.X * size.Y
+	if len(e.buf) != 3*n {
+		e.buf = make([]byte, 3*n)
+	}
+	for plane := 0; plane < 3; plane++ {
+		out := e.buf[plane*n : (plane+1)*n]
+		for y := 0; y < size.Y; y++ {
+			for x, index := range img.Pix[y*img.Stride : y*img.Stride+size.X] {
+				out[y*size.X+x] = ycbcr[plane][index]
+			}
+		}
+	}
+	// The stream has a constant rate, so the frame is repeated for every tick.
+	for i := 0; i < ticks; i++ {
+		e.w.WriteString("FRAME\n")
+		if _, err := e.w.Write(e.buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *y4mEncoder) Close() error {
+	err := e.w.Flush()
+	if e.closer != nil {
+		if cerr := e.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package chip8
+
+import (
+	"bufio"
+	"compress/lzw"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+)
+
+// gifMinDelay is the shortest delay of a frame, in hundredths of a second, which the browsers and most
+// viewers honor: shorter delays are played as 10 hundredths, making the animation much slower.
+const gifMinDelay = 2
+
+// gifEncoder streams the frames as an animated GIF, looping forever. Every frame is written as soon as
+// its delay is known, so the recording does not grow in memory.
+type gifEncoder struct {
+	w      *bufio.Writer
+	closer io.Closer
+	header bool
+	size   image.Point
+
+	// pending is the last frame, shown from the tick start to the tick end of the recording.
+	pending    *image.Paletted
+	start, end int
+}
+
+// NewGIFEncoder returns a VideoEncoder writing an animated GIF to w. The ticks are merged so that every
+// frame lasts at least 2 hundredths of a second: a frame shorter than that is replaced by the next one.
+// Closing it closes w when it is an io.Closer.
+func NewGIFEncoder(w io.Writer) VideoEncoder {
+	e := &gifEncoder{w: bufio.NewWriter(w)}
+	e.closer, _ = w.(io.Closer)
+	return e
+}
+
+// gifDelay returns the delay of a frame from the tick start to the tick end, in hundredths of a second.
+// The delays are rounded from the start of the recording, so that the errors do not add up.
+func gifDelay(start, end int) int {
+	return end*100/timerFrequency - start*100/timerFrequency
+}
+
+func (e *gifEncoder) WriteFrame(img *image.Paletted, ticks int) error {
+	if e.pending != nil && gifDelay(e.start, e.end) >= gifMinDelay {
+		if err := e.writeFrame(e.pending, gifDelay(e.start, e.end)); err != nil {
+			return err
+		}
+		e.start = e.end
+	}
+	e.pending = img
+	e.end += ticks
+	return nil
+}
+
+func (e *gifEncoder) Close() error {
+	var err error
+	if e.pending != nil {
+		delay := gifDelay(e.start, e.end)
+		if delay < gifMinDelay {
+			delay = gifMinDelay
+		}
+		err = e.writeFrame(e.pending, delay)
+	}
+	if err == nil && e.header {
+		e.w.WriteByte(0x3B)
+	}
+	if ferr := e.w.Flush(); err == nil {
+		err = ferr
+	}
+	if e.closer != nil {
+		if cerr := e.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// writeFrame writes img shown for delay hundredths of a second, after the header of the file for the
+// first frame.
+func (e *gifEncoder) writeFrame(img *image.Paletted, delay int) error {
+	size := img.Bounds().Size()
+	if !e.header {
+		e.size = size
+		e.w.WriteString("GIF89a")
+		// The logical screen, without a global color table: every frame has its own.
+		binary.Write(e.w, binary.LittleEndian, [2]uint16{uint16(size.X), uint16(size.Y)})
+		e.w.Write([]byte{0x00, 0x00, 0x00})
+		// The NETSCAPE2.0 extension makes the animation loop forever.
+		e.w.Write([]byte{0x21, 0xFF, 0x0B})
+		e.w.WriteString("NETSCAPE2.0")
+		e.w.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+		e.header = true
+	}
+	if size != e.size {
+		return fmt.Errorf("frame of %dx%d in a %dx%d GIF", size.X, size.Y, e.size.X, e.size.Y)
+	}
+	if len(img.Palette) == 0 || len(img.Palette) > 256 {
+		return fmt.Errorf("palette of %d colors in a GIF", len(img.Palette))
+	}
+
+	// The graphic control extension holds the delay.
+	e.w.Write([]byte{0x21, 0xF9, 0x04, 0x00, byte(delay), byte(delay >> 8), 0x00, 0x00})
+
+	// The color table has 2^(bits+1) colors.
+	bits := 0
+	for 1<<(bits+1) < len(img.Palette) {
+		bits++
+	}
+	e.w.WriteByte(0x2C)
+	binary.Write(e.w, binary.LittleEndian, [4]uint16{0, 0, uint16(size.X), uint16(size.Y)})
+	e.w.WriteByte(0x80 | byte(bits))
+	table := make([]byte, 3<<(bits+1))
+	for i, c := range img.Palette {
+		r, g, b, _ := c.RGBA()
+		table[3*i], table[3*i+1], table[3*i+2] = byte(r>>8), byte(g>>8), byte(b>>8)
+	}
+	e.w.Write(table)
+
+	// The indexes are compressed with LZW, in sub-blocks of up to 255 bytes.
+	litWidth := bits + 1
+	if litWidth < 2 {
+		litWidth = 2
+	}
+	e.w.WriteByte(byte(litWidth))
+	blocks := &gifBlockWriter{w: e.w}
+	lw := lzw.NewWriter(blocks, lzw.LSB, litWidth)
+	for y := 0; y < size.Y; y++ {
+		if _, err := lw.Write(img.Pix[y*img.Stride : y*img.Stride+size.X]); err != nil {
+			return err
+		}
+	}
+	if err := lw.Close(); err != nil {
+		return err
+	}
+	blocks.flush()
+	return e.w.WriteByte(0x00)
+}
+
+// gifBlockWriter splits the data written to it into the sub-blocks of a GIF.
+type gifBlockWriter struct {
+	w   *bufio.Writer
+	buf [255]byte
+	n   int
+}
+
+func (b *gifBlockWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(b.buf[b.n:], p)
+		b.n += n
+		p = p[n:]
+		if b.n == len(b.buf) {
+			if err := b.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush writes the buffered data as a sub-block.
+func (b *gifBlockWriter) flush() error {
+	if b.n == 0 {
+		return nil
+	}
+	b.w.WriteByte(byte(b.n))
+	_, err := b.w.Write(b.buf[:b.n])
+	b.n = 0
+	return err
+}
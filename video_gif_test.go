@@ -0,0 +1,52 @@
+package chip8
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"testing"
+)
+
+func TestGIFEncoderDelays(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewGIFEncoder(&buf)
+	// 2 seconds of frames changing at every tick, then one lasting 1 second.
+	for i := 0; i < 2*timerFrequency; i++ {
+		img := image.NewPaletted(image.Rect(0, 0, 16, 8), DefaultPalette[:])
+		img.Pix[i%len(img.Pix)] = 1
+		if err := enc.WriteFrame(img, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := image.NewPaletted(image.Rect(0, 0, 16, 8), DefaultPalette[:])
+	if err := enc.WriteFrame(last, timerFrequency); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for i, delay := range anim.Delay {
+		if delay < gifMinDelay {
+			t.Errorf("frame %d lasts %d hundredths of a second", i, delay)
+		}
+		total += delay
+	}
+	if total != 300 {
+		t.Errorf("animation lasts %d hundredths of a second, want 300", total)
+	}
+	if got := anim.Delay[len(anim.Delay)-1]; got != 100 {
+		t.Errorf("last frame lasts %d hundredths of a second, want 100", got)
+	}
+	if !bytes.Equal(anim.Image[len(anim.Image)-1].Pix, last.Pix) {
+		t.Error("last frame differs")
+	}
+	if anim.LoopCount != 0 {
+		t.Errorf("loop count %d, want 0 to loop forever", anim.LoopCount)
+	}
+}
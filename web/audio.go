@@ -0,0 +1,108 @@
+//go:build js && wasm
+
+package web
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"syscall/js"
+
+	"github.com/imrenagi/chip8"
+)
+
+const (
+	// samplesPerFrame is the number of samples of a tick of the 60Hz timer.
+	samplesPerFrame = chip8.SampleRate / 60
+	// minLatency and maxLatency bound how far ahead of the audio clock the frames are scheduled. The frames
+	// past maxLatency are dropped, when the timer of the CPU runs faster than the audio clock.
+	minLatency = 0.05
+	maxLatency = 0.2
+)
+
+// WebAudioSink plays the buzzer with the Web Audio API. Every call to Start, made once per frame by the CPU,
+// schedules a frame of the tone after the previous one.
+type WebAudioSink struct {
+	tone    *chip8.Tone
+	ctx     js.Value
+	samples []float32
+	bytes   []byte
+	data    js.Value
+	floats  js.Value
+	next    float64
+}
+
+// NewWebAudioSink returns a WebAudioSink playing the tone of config. Browsers only play the sound once the
+// page got a user gesture, see Resume.
+func NewWebAudioSink(config chip8.ToneConfig) (*WebAudioSink, error) {
+	tone, err := chip8.NewTone(config)
+	if err != nil {
+		return nil, err
+	}
+	audioContext := js.Global().Get("AudioContext")
+	if audioContext.IsUndefined() {
+		return nil, errors.New("Web Audio is not supported by the browser")
+	}
+	s := &WebAudioSink{
+		tone:    tone,
+		ctx:     audioContext.New(map[string]interface{}{"sampleRate": chip8.SampleRate}),
+		samples: make([]float32, samplesPerFrame),
+		bytes:   make([]byte, 4*samplesPerFrame),
+	}
+	s.data = js.Global().Get("Uint8Array").New(len(s.bytes))
+	s.floats = js.Global().Get("Float32Array").New(s.data.Get("buffer"))
+	return s, nil
+}
+
+// Resume starts the audio when the browser suspended it, which it only allows while handling a user
+// gesture, e.g. a click.
+func (s *WebAudioSink) Resume() {
+	s.ctx.Call("resume")
+}
+
+func (s *WebAudioSink) Start() error {
+	s.tone.SetOn(true)
+	now := s.ctx.Get("currentTime").Float()
+	if s.next < now+minLatency {
+		s.next = now + minLatency
+	}
+	if s.next > now+maxLatency {
+		return nil
+	}
+
+	s.tone.Generate(s.samples)
+	for i, sample := range s.samples {
+		binary.LittleEndian.PutUint32(s.bytes[4*i:], math.Float32bits(sample))
+	}
+	js.CopyBytesToJS(s.data, s.bytes)
+	buffer := s.ctx.Call("createBuffer", 1, samplesPerFrame, chip8.SampleRate)
+	buffer.Call("copyToChannel", s.floats, 0)
+	source := s.ctx.Call("createBufferSource")
+	source.Set("buffer", buffer)
+	source.Call("connect", s.ctx.Get("destination"))
+	source.Call("start", s.next)
+	s.next += float64(samplesPerFrame) / chip8.SampleRate
+	return nil
+}
+
+func (s *WebAudioSink) Stop() error {
+	s.tone.SetOn(false)
+	return nil
+}
+
+func (s *WebAudioSink) SetPattern(pattern [16]uint8) {
+	s.tone.SetPattern(pattern)
+}
+
+func (s *WebAudioSink) ClearPattern() {
+	s.tone.ClearPattern()
+}
+
+func (s *WebAudioSink) SetPitch(pitch uint8) {
+	s.tone.SetPitch(pitch)
+}
+
+func (s *WebAudioSink) Close() error {
+	s.ctx.Call("close")
+	return nil
+}
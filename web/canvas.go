@@ -0,0 +1,71 @@
+//go:build js && wasm
+
+// Package web runs the emulator in a browser, compiled to WebAssembly: it draws the display on a canvas,
+// plays the buzzer with Web Audio and presses the keypad with the keyboard events of the page.
+package web
+
+import (
+	"image/color"
+	"sync"
+	"syscall/js"
+
+	"github.com/imrenagi/chip8"
+)
+
+// screenWidth and screenHeight are the size of the 128x64 screen the drawers are given the pixels of.
+const (
+	screenWidth  = 128
+	screenHeight = 64
+)
+
+// CanvasDrawer is a Drawer rendering the display on a canvas, one pixel of the canvas per pixel of the 128x64
+// screen. The canvas is scaled up with CSS, e.g. with "image-rendering: pixelated".
+type CanvasDrawer struct {
+	mu      sync.Mutex
+	ctx     js.Value
+	image   js.Value
+	data    js.Value
+	back    [screenWidth * screenHeight * 4]byte
+	palette [4][4]byte
+}
+
+// NewCanvasDrawer returns a CanvasDrawer drawing on canvas with palette, e.g. chip8.DefaultPalette.
+func NewCanvasDrawer(canvas js.Value, palette chip8.Palette) *CanvasDrawer {
+	canvas.Set("width", screenWidth)
+	canvas.Set("height", screenHeight)
+	d := &CanvasDrawer{ctx: canvas.Call("getContext", "2d")}
+	for i, c := range palette {
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		d.palette[i] = [4]byte{rgba.R, rgba.G, rgba.B, 0xff}
+	}
+	// The pixels are copied to a Uint8Array sharing its buffer with the ImageData put on the canvas.
+	d.data = js.Global().Get("Uint8Array").New(len(d.back))
+	clamped := js.Global().Get("Uint8ClampedArray").New(d.data.Get("buffer"))
+	d.image = js.Global().Get("ImageData").New(clamped, screenWidth, screenHeight)
+	d.Clear()
+	return d
+}
+
+func (d *CanvasDrawer) Clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := 0; i < len(d.back); i += 4 {
+		copy(d.back[i:], d.palette[0][:])
+	}
+}
+
+func (d *CanvasDrawer) SetPixel(x, y int, color uint8) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	copy(d.back[(y*screenWidth+x)*4:], d.palette[color&0x3][:])
+}
+
+func (d *CanvasDrawer) Draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	js.CopyBytesToJS(d.data, d.back[:])
+	d.ctx.Call("putImageData", d.image, 0, 0)
+}
+
+// Stop leaves the last frame on the canvas, so that the drawer can be given to the display of another CPU.
+func (d *CanvasDrawer) Stop() {}
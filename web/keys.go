@@ -0,0 +1,50 @@
+//go:build js && wasm
+
+package web
+
+import (
+	"strings"
+	"syscall/js"
+
+	"github.com/imrenagi/chip8"
+)
+
+// KeyName returns the name of the key of a keyboard event by its code, the position of the key, as bound
+// in a chip8.Keymap: "KeyX" is "X", "Digit1" is "1", "ArrowUp" is "Up" and "Numpad8" is "Keypad 8".
+func KeyName(code string) string {
+	for prefix, name := range map[string]string{"Key": "", "Digit": "", "Arrow": "", "Numpad": "Keypad "} {
+		if strings.HasPrefix(code, prefix) {
+			return name + strings.TrimPrefix(code, prefix)
+		}
+	}
+	return code
+}
+
+// ListenKeys presses the keys of keyboard bound in keymap with the keyboard events of target, e.g. the
+// document, and returns the function removing the listeners.
+func ListenKeys(target js.Value, keyboard *chip8.Keyboard, keymap chip8.Keymap) (remove func()) {
+	listener := func(pressed bool) js.Func {
+		return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			event := args[0]
+			key, ok := keymap.Key(KeyName(event.Get("code").String()))
+			if !ok {
+				return nil
+			}
+			// The keys of the keypad do not scroll the page or type in it.
+			event.Call("preventDefault")
+			if !event.Get("repeat").Bool() {
+				keyboard.Accept(chip8.NewKeyEvent(pressed, key))
+			}
+			return nil
+		})
+	}
+	down, up := listener(true), listener(false)
+	target.Call("addEventListener", "keydown", down)
+	target.Call("addEventListener", "keyup", up)
+	return func() {
+		target.Call("removeEventListener", "keydown", down)
+		target.Call("removeEventListener", "keyup", up)
+		down.Release()
+		up.Release()
+	}
+}
@@ -0,0 +1,150 @@
+//go:build js && wasm
+
+// Command wasm is the emulator running in a browser, see index.html. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o web/wasm/chip8.wasm ./web/wasm
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"syscall/js"
+
+	"github.com/imrenagi/chip8"
+	"github.com/imrenagi/chip8/web"
+	"github.com/rs/zerolog"
+)
+
+// emulator runs the ROMs picked on the page, one at a time.
+type emulator struct {
+	document js.Value
+	drawer   *web.CanvasDrawer
+	keyboard *chip8.Keyboard
+	cancel   context.CancelFunc
+	// unlisten removes the listeners of the keys of the keymap picked.
+	unlisten func()
+}
+
+func main() {
+	zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+	document := js.Global().Get("document")
+	e := &emulator{
+		document: document,
+		drawer:   web.NewCanvasDrawer(element(document, "screen"), chip8.DefaultPalette),
+		keyboard: chip8.NewKeyboard(),
+	}
+	e.unlisten = web.ListenKeys(document, e.keyboard, chip8.DefaultKeymap)
+
+	picker := element(document, "rom")
+	picker.Call("addEventListener", "change", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		files := picker.Get("files")
+		if files.Length() == 0 {
+			return nil
+		}
+		// The sound is created while handling the user gesture, so that the browser plays it.
+		audio, err := web.NewWebAudioSink(chip8.DefaultTone)
+		if err != nil {
+			e.status(err.Error())
+			return nil
+		}
+		audio.Resume()
+		// The handlers must not block: the file is read by a goroutine.
+		go e.load(files.Index(0), audio)
+		return nil
+	}))
+	e.status("Pick a ROM to start.")
+	select {}
+}
+
+func element(document js.Value, id string) js.Value {
+	return document.Call("getElementById", id)
+}
+
+// status shows msg below the screen.
+func (e *emulator) status(msg string) {
+	element(e.document, "status").Set("textContent", msg)
+}
+
+// load stops the ROM running, if any, and runs the program of file.
+func (e *emulator) load(file js.Value, audio *web.WebAudioSink) {
+	program, err := readFile(file)
+	if err != nil {
+		audio.Close()
+		e.status(fmt.Sprintf("Unable to read %s: %s", file.Get("name").String(), err))
+		return
+	}
+	quirksName := element(e.document, "quirks").Get("value").String()
+	quirks, ok := chip8.QuirksPresets[quirksName]
+	if !ok {
+		quirks = chip8.QuirksLegacy
+	}
+	keymap, ok := chip8.KeymapPresets[element(e.document, "keymap").Get("value").String()]
+	if !ok {
+		keymap = chip8.DefaultKeymap
+	}
+	speed, err := strconv.Atoi(element(e.document, "speed").Get("value").String())
+	if err != nil || speed < 1 {
+		speed = 500
+	}
+
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.unlisten()
+	e.unlisten = web.ListenKeys(e.document, e.keyboard, keymap)
+	display := chip8.NewDisplay(e.drawer)
+	c := chip8.NewCPU(&display, e.keyboard, audio, quirks)
+	c.SetSpeed(speed)
+	if err := c.LoadProgramBytes(program); err != nil {
+		audio.Close()
+		e.status(err.Error())
+		return
+	}
+	var ctx context.Context
+	ctx, e.cancel = context.WithCancel(context.Background())
+	go c.Start(ctx)
+	e.status(fmt.Sprintf("Running %s with the %s quirks.", file.Get("name").String(), quirksName))
+
+	go func() {
+		select {
+		case err := <-c.Errors():
+			e.status(fmt.Sprintf("The emulator stopped: %s", err))
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// readFile returns the content of a File of the page.
+func readFile(file js.Value) ([]byte, error) {
+	buffer, err := await(file.Call("arrayBuffer"))
+	if err != nil {
+		return nil, err
+	}
+	data := js.Global().Get("Uint8Array").New(buffer)
+	b := make([]byte, data.Length())
+	js.CopyBytesToGo(b, data)
+	return b, nil
+}
+
+// await waits for promise to settle, and returns its value or the reason it was rejected for.
+func await(promise js.Value) (js.Value, error) {
+	type result struct {
+		value js.Value
+		err   error
+	}
+	ch := make(chan result, 1)
+	then := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		ch <- result{value: args[0]}
+		return nil
+	})
+	defer then.Release()
+	catch := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		ch <- result{err: js.Error{Value: args[0]}}
+		return nil
+	})
+	defer catch.Release()
+	promise.Call("then", then, catch)
+	r := <-ch
+	return r.value, r.err
+}